@@ -0,0 +1,328 @@
+package orderednodes
+
+// This file computes content hashes (SHA-256) of the files in a tree,
+// and Merkle digests of its subtrees: a Nord's digest covers the names,
+// kinds, order and contents of everything under it (but not its own
+// name), so that two subtrees have the same digest if and only if
+// (barring hash collisions) they have the same contents. So comparing
+// a dir's digest to an earlier one says whether anything under it has
+// changed, and equal digests in different trees find duplicates.
+//
+// Digests are cached, and a Nord's cached digest (and those of its
+// ancestors) is dropped whenever its subtree is changed using this
+// package, including by [Reconcile] and by a [Watcher]. A change on
+// disk is not seen until then.
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+)
+
+// Digest is a SHA-256 hash.
+type Digest [sha256.Size]byte
+
+// String is the Digest in hex.
+func (d Digest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// The kinds of Nord, as they are hashed.
+const (
+	digestFile = 'f'
+	digestLink = 'l'
+	digestDir  = 'd'
+)
+
+var (
+	emptyFileDigest = leafDigest(digestFile, sha256.Sum256(nil))
+	emptyDirDigest  = Digest(sha256.Sum256([]byte{digestDir}))
+)
+
+// ContentHash returns the SHA-256 hash of a file's contents, reading
+// the file in a stream (rather than loading it), or of the target of
+// a symlink. It is cached, until the file is found to be modified
+// (by [Reconcile] or a [Watcher]). For a dir, it is an error.
+func (p *FilePropsNord) ContentHash() (Digest, error) {
+	if d := p.cachedContentHash(); d != nil {
+		return *d, nil
+	}
+	var d Digest
+	var e error
+	switch {
+	case p.IsSymlink():
+		d = sha256.Sum256([]byte(p.linkTarget))
+	case p.FI != nil && p.FI.IsDir():
+		return d, fmt.Errorf("ContentHash: <%s> is a dir", p.AbsFP())
+	default:
+		d, e = hashFile(p.AbsFP())
+		if e != nil {
+			return d, fmt.Errorf("ContentHash: %w", e)
+		}
+	}
+	digestMu.Lock()
+	p.contentHash = &d
+	digestMu.Unlock()
+	return d, nil
+}
+
+func (p *FilePropsNord) cachedContentHash() *Digest {
+	digestMu.Lock()
+	defer digestMu.Unlock()
+	return p.contentHash
+}
+
+// digestMu guards the cached digests and content hashes, because
+// they are computed (and cached) by funcs that only read the tree,
+// and so by concurrent readers.
+var digestMu sync.Mutex
+
+// cachedDigest returns p's cached digest, or nil.
+func (p *Nord) cachedDigest() *Digest {
+	digestMu.Lock()
+	defer digestMu.Unlock()
+	return p.digest
+}
+
+// setDigest caches d as p's digest.
+func (p *Nord) setDigest(d Digest) {
+	digestMu.Lock()
+	p.digest = &d
+	digestMu.Unlock()
+}
+
+// hashFile returns the SHA-256 hash of the file at path.
+func hashFile(path string) (Digest, error) {
+	var d Digest
+	f, e := os.Open(path)
+	if e != nil {
+		return d, e
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, e := io.Copy(h, f); e != nil {
+		return d, e
+	}
+	h.Sum(d[:0])
+	return d, nil
+}
+
+// dropDigests drops the cached digests of p and its ancestors.
+// Since a cached digest implies cached digests for all of its
+// descendants, it stops at the first Nord that has none.
+func (p *Nord) dropDigests() {
+	digestMu.Lock()
+	defer digestMu.Unlock()
+	var g loopGuard
+	for n := p; n != nil && n.digest != nil; n = n.parent.nord() {
+		n.digest = nil
+		if n.parent == nil || g.loops(n.parent) {
+			return
+		}
+	}
+}
+
+// MerkleDigest returns the digest of the subtree of p, computing
+// (and caching) the digests of any Nords under it that have none.
+//
+// A Nord with kids (or that is a dir) is hashed from its kids' names
+// and digests, in kid order. A leaf is hashed from its contents: for
+// a symlink, its target; for a [FilePropsNord], its [ContentHash];
+// for anything else, the file at its AbsFP (so for a Nord that is
+// not in a file tree, it is an error).
+// .
+func MerkleDigest(p Norder) (Digest, error) {
+	e := inspectTreeIteratively(p,
+		func(n Norder) error {
+			if n.nord().cachedDigest() != nil {
+				return SkipDir
+			}
+			return nil
+		},
+		func(n Norder) error {
+			if n.nord().cachedDigest() != nil {
+				return nil
+			}
+			d, e := nordDigest(n)
+			if e != nil {
+				return e
+			}
+			n.nord().setDigest(d)
+			return nil
+		}, "MerkleDigest")
+	if e != nil {
+		return Digest{}, fmt.Errorf("MerkleDigest: %w", e)
+	}
+	return *p.nord().cachedDigest(), nil
+}
+
+// HashTree is [MerkleDigest], but the leaves (which is where the
+// files are read) are hashed first, in parallel, by up to workers
+// goroutines, as for [ParallelInspect]. Any [LazyDirNord] dirs that
+// are not read yet are read first, by a sequential walk, so that the
+// parallel walk does not modify the tree.
+func HashTree(root Norder, workers int) (Digest, error) {
+	e := inspectTreeIteratively(root, func(n Norder) error {
+		if n.nord().cachedDigest() != nil {
+			return SkipDir
+		}
+		// Just getting the kids reads a lazy dir.
+		return nil
+	}, nil, "HashTree")
+	if e != nil {
+		return Digest{}, fmt.Errorf("HashTree: %w", e)
+	}
+	e = ParallelInspect(root, workers, func(n Norder) error {
+		nn := n.nord()
+		if nn.cachedDigest() != nil {
+			return SkipDir
+		}
+		if n.IsDir() || n.HasKids() {
+			return nil
+		}
+		d, e := nordDigest(n)
+		if e != nil {
+			return e
+		}
+		nn.setDigest(d)
+		return nil
+	})
+	if e != nil {
+		return Digest{}, fmt.Errorf("HashTree: %w", e)
+	}
+	return MerkleDigest(root)
+}
+
+// nordDigest computes n's digest, from its kids' digests (which
+// must be set) or from its contents.
+func nordDigest(n Norder) (Digest, error) {
+	if n.IsDir() || n.HasKids() {
+		h := sha256.New()
+		h.Write([]byte{digestDir})
+		var g loopGuard
+		for k := n.FirstKid(); k != nil; k = k.NextKid() {
+			if g.loops(k) {
+				return Digest{}, kidLoopError("MerkleDigest", n, k)
+			}
+			writeDigestEntry(h, kidName(k), *k.nord().cachedDigest())
+		}
+		var d Digest
+		h.Sum(d[:0])
+		return d, nil
+	}
+	if t := n.LinkTarget(); t != "" {
+		return leafDigest(digestLink, sha256.Sum256([]byte(t))), nil
+	}
+	var c Digest
+	var e error
+	if fp, ok := n.(*FilePropsNord); ok {
+		c, e = fp.ContentHash()
+	} else {
+		c, e = hashFile(n.AbsFP())
+	}
+	if e != nil {
+		return c, e
+	}
+	return leafDigest(digestFile, c), nil
+}
+
+// leafDigest is the digest of a leaf of the kind
+// kind whose contents have the hash c.
+func leafDigest(kind byte, c Digest) Digest {
+	return sha256.Sum256(append([]byte{kind}, c[:]...))
+}
+
+// writeDigestEntry writes a kid's name (with its
+// length, so that it is unambiguous) and digest.
+func writeDigestEntry(h hash.Hash, name string, d Digest) {
+	h.Write(binary.AppendUvarint(nil, uint64(len(name))))
+	h.Write([]byte(name))
+	h.Write(d[:])
+}
+
+// DuplicateSubtrees finds subtrees (including single files) that
+// have the same digest, under any of the roots, and returns them in
+// groups, in the order they are first found (in preorder, root by
+// root). Only the topmost duplicates are reported: if two dirs are
+// duplicates, then so is everything under them, but that is not
+// reported again. But if only one of a group's Nords is not under
+// such a dir, then the group is still reported, with the first of
+// its other Nords added, to show what it duplicates. Empty files and
+// empty dirs are not reported.
+// .
+func DuplicateSubtrees(roots ...Norder) ([][]Norder, error) {
+	var count = make(map[Digest]int)
+	for _, r := range roots {
+		if _, e := MerkleDigest(r); e != nil {
+			return nil, fmt.Errorf("DuplicateSubtrees: %w", e)
+		}
+		InspectTree(r, func(n Norder) error {
+			count[*n.nord().cachedDigest()]++
+			return nil
+		})
+	}
+	isDup := func(n Norder) (Digest, bool) {
+		d := *n.nord().cachedDigest()
+		return d, count[d] >= 2 && d != emptyFileDigest && d != emptyDirDigest
+	}
+	// Group all of the duplicates, noting (by the number
+	// of duplicates that are open) which ones are under
+	// other duplicates, and so are not topmost.
+	type member struct {
+		n     Norder
+		under bool
+	}
+	var groups [][]member
+	var groupOf = make(map[Digest]int)
+	var open int
+	var ee []error
+	for _, r := range roots {
+		ee = append(ee, InspectTreeWithPreAndPost(r,
+			func(n Norder) error {
+				d, ok := isDup(n)
+				if !ok {
+					return nil
+				}
+				i, ok := groupOf[d]
+				if !ok {
+					i = len(groups)
+					groupOf[d] = i
+					groups = append(groups, nil)
+				}
+				groups[i] = append(groups[i], member{n, open > 0})
+				open++
+				return nil
+			},
+			func(n Norder) error {
+				if _, ok := isDup(n); ok {
+					open--
+				}
+				return nil
+			}))
+	}
+	var out [][]Norder
+	for _, g := range groups {
+		var top []Norder
+		var firstUnder Norder
+		for _, m := range g {
+			if !m.under {
+				top = append(top, m.n)
+			} else if firstUnder == nil {
+				firstUnder = m.n
+			}
+		}
+		if len(top) == 1 {
+			top = append(top, firstUnder)
+		}
+		if len(top) >= 2 {
+			out = append(out, top)
+		}
+	}
+	return out, errors.Join(ee...)
+}
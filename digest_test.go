@@ -0,0 +1,91 @@
+package orderednodes
+
+import (
+	"os"
+	FP "path/filepath"
+	"slices"
+	"testing"
+)
+
+// digestTestDir makes the files (by relative path, with their
+// contents) under a temp dir, and returns the dir.
+func digestTestDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	d := t.TempDir()
+	for rel, s := range files {
+		path := FP.Join(d, rel)
+		if e := os.MkdirAll(FP.Dir(path), 0755); e != nil {
+			t.Fatal(e)
+		}
+		if e := os.WriteFile(path, []byte(s), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	return d
+}
+
+func TestDuplicateSubtrees(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  [][]string
+	}{
+		{"none", map[string]string{"a": "1", "b": "2"}, nil},
+		{"files", map[string]string{"a": "1", "b": "1", "c": "2"},
+			[][]string{{"a", "b"}}},
+		{"dirs, not what is under them", map[string]string{
+			"x/a": "1", "x/b/c": "2", "y/a": "1", "y/b/c": "2"},
+			[][]string{{"x", "y"}}},
+		{"a file that duplicates one in a duplicate dir", map[string]string{
+			"x/a": "1", "x/b": "2", "y/a": "1", "y/b": "2", "z": "1"},
+			[][]string{{"x", "y"}, {"z", "x/a"}}},
+		{"empty files", map[string]string{"a": "", "b": ""}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, e := NewDirTree(digestTestDir(t, tc.files), nil)
+			if e != nil {
+				t.Fatal(e)
+			}
+			gg, e := DuplicateSubtrees(r)
+			if e != nil {
+				t.Fatal(e)
+			}
+			var got [][]string
+			for _, g := range gg {
+				var names []string
+				for _, n := range g {
+					names = append(names, n.RelFP())
+				}
+				got = append(got, names)
+			}
+			if !slices.EqualFunc(got, tc.want, slices.Equal) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHashTreeLazy(t *testing.T) {
+	d := digestTestDir(t, map[string]string{
+		"x/a": "1", "x/b/c": "2", "y/a": "3"})
+	r, e := NewDirTree(d, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	want, e := MerkleDigest(r)
+	if e != nil {
+		t.Fatal(e)
+	}
+	lz, e := NewLazyDirTree(d, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	got, e := HashTree(lz, 4)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
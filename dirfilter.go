@@ -0,0 +1,219 @@
+package orderednodes
+
+// This file has the filters that decide which disk items go in
+// a tree built by [NewDirTree] (and kept up to date by [Reconcile]).
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	FP "path/filepath"
+	S "strings"
+
+	DS "github.com/bmatcuk/doublestar/v4"
+	FU "github.com/fbaube/fileutils"
+)
+
+// HiddenMode says what [NewDirTree] and [ReconcileWith] do
+// with a hidden item, i.e. one whose name starts with ".".
+type HiddenMode int
+
+const (
+	// HiddenKeep keeps hidden items.
+	HiddenKeep HiddenMode = iota
+	// HiddenSkip leaves out hidden files and dirs.
+	HiddenSkip
+	// HiddenSkipDirs leaves out hidden dirs (like ".git")
+	// but keeps hidden files (like ".htaccess").
+	HiddenSkipDirs
+)
+
+// IgnoreFileNames are the files read when [DirTreeOptions]
+// IgnoreFiles is set, in order.
+var IgnoreFileNames = []string{".gitignore", ".ignore"}
+
+// dirScan is the state of one call to [NewDirTree] or [ReconcileWith],
+// or of a tree of [LazyDirNord]s, for as long as it is used.
+type dirScan struct {
+	opts *DirTreeOptions
+	// lazy is set for a tree of [LazyDirNord]s, whose
+	// dirs are not read until their kids are needed.
+	lazy bool
+	// ignores caches each dir's ignore rules,
+	// which include those of its ancestors.
+	ignores map[*Nord][]ignoreRule
+}
+
+// ignoreRule is a pattern from an ignore file.
+type ignoreRule struct {
+	// base is the relPath (with "/" separators) of the ignore
+	// file's dir, or "" for the root.
+	base    string
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// newDirScan checks the options' globs.
+func newDirScan(opts *DirTreeOptions) (*dirScan, error) {
+	if opts != nil {
+		for _, pp := range [][]string{opts.Include, opts.Exclude} {
+			for _, p := range pp {
+				if !DS.ValidatePattern(p) {
+					return nil, fmt.Errorf("bad glob %q: %w", p, DS.ErrBadPattern)
+				}
+			}
+		}
+	}
+	return &dirScan{opts: opts, ignores: make(map[*Nord][]ignoreRule)}, nil
+}
+
+// readDir returns the items in the directory of par that go in
+// the tree, in lexical order, each resolved (see [resolve]) just
+// once. If par is at MaxDepth, its directory is not read.
+func (sc *dirScan) readDir(par Norder) ([]dirItem, error) {
+	o := sc.opts
+	if o != nil && o.MaxDepth > 0 && par.Level() >= o.MaxDepth {
+		return nil, nil
+	}
+	ents, e := os.ReadDir(par.AbsFP())
+	if e != nil {
+		return nil, e
+	}
+	var rules []ignoreRule
+	if o != nil && o.IgnoreFiles {
+		rules = sc.ignoreRules(par)
+	}
+	var items = make([]dirItem, 0, len(ents))
+	for _, d := range ents {
+		if o.symlinks() == SymlinkSkip && d.Type()&fs.ModeSymlink != 0 {
+			continue
+		}
+		it := o.resolve(par, d)
+		if o == nil || sc.keep(par, it, rules) {
+			items = append(items, it)
+		}
+	}
+	return items, nil
+}
+
+// keep is true if the item it in par's dir goes in the tree.
+func (sc *dirScan) keep(par Norder, it dirItem, rules []ignoreRule) bool {
+	o := sc.opts
+	name := it.d.Name()
+	isDir := it.d.IsDir()
+	if it.d.Type()&fs.ModeSymlink != 0 {
+		// Match a link to a dir as a dir.
+		isDir = it.targetIsDir
+	}
+	if S.HasPrefix(name, ".") && (o.Hidden == HiddenSkip ||
+		(o.Hidden == HiddenSkipDirs && isDir)) {
+		return false
+	}
+	rel := FP.ToSlash(kidRelPath(par, name))
+	for _, p := range o.Exclude {
+		if ok, _ := DS.Match(p, rel); ok {
+			return false
+		}
+	}
+	if isIgnored(rules, rel, isDir) {
+		return false
+	}
+	if isDir || len(o.Include) == 0 {
+		return true
+	}
+	for _, p := range o.Include {
+		if ok, _ := DS.Match(p, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreRules returns the rules that apply in par's dir,
+// reading ignore files as needed.
+func (sc *dirScan) ignoreRules(par Norder) []ignoreRule {
+	if rr, ok := sc.ignores[par.nord()]; ok {
+		return rr
+	}
+	var rr []ignoreRule
+	var base string
+	if !par.IsRoot() && par.Parent() != nil {
+		rr = sc.ignoreRules(par.Parent())
+		base = FP.ToSlash(FU.StripTrailingPathSep(par.RelFP()))
+	}
+	// Copy, so as not to share an ancestor's array.
+	rr = append([]ignoreRule(nil), rr...)
+	for _, fn := range IgnoreFileNames {
+		rr = append(rr, readIgnoreFile(FP.Join(par.AbsFP(), fn), base)...)
+	}
+	sc.ignores[par.nord()] = rr
+	return rr
+}
+
+// readIgnoreFile returns the rules in the ignore file at path,
+// or none if it does not exist.
+func readIgnoreFile(path, base string) []ignoreRule {
+	f, e := os.Open(path)
+	if e != nil {
+		return nil
+	}
+	defer f.Close()
+	var rr []ignoreRule
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := S.TrimRight(sc.Text(), " \t\r")
+		if line == "" || S.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{base: base}
+		if S.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if S.HasPrefix(line, `\`) {
+			// An escaped "#" or "!".
+			line = line[1:]
+		}
+		if S.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = S.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if S.Contains(line, "/") {
+			// Anchored to the ignore file's dir.
+			line = S.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		if !DS.ValidatePattern(line) {
+			continue
+		}
+		r.pattern = line
+		rr = append(rr, r)
+	}
+	return rr
+}
+
+// isIgnored is true if the last rule that matches rel ignores it.
+func isIgnored(rules []ignoreRule, rel string, isDir bool) bool {
+	var ignored bool
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if r.base != "" {
+			var ok bool
+			if sub, ok = S.CutPrefix(rel, r.base+"/"); !ok {
+				continue
+			}
+		}
+		if ok, _ := DS.Match(r.pattern, sub); ok {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
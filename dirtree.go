@@ -0,0 +1,428 @@
+package orderednodes
+
+// This file builds a tree of Nords from a directory on disk, and
+// brings such a tree up to date with the disk (see [Reconcile]).
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	FP "path/filepath"
+
+	FU "github.com/fbaube/fileutils"
+	L "github.com/fbaube/mlog"
+)
+
+// DirTreeOptions configures [NewDirTree] and [ReconcileWith].
+// A nil *DirTreeOptions is the same as the zero value.
+//
+// The filters (Symlinks, Include, Exclude, MaxDepth, Hidden and
+// IgnoreFiles) are all applied, and an item is left out if any
+// of them says so. Globs are matched against the relPath with
+// "/" as the separator.
+//
+// With IgnoreFiles, the patterns in a dir's .gitignore and .ignore
+// (in that order) apply in that dir and below it, and override those
+// of its ancestors (up to the root, but not above it). They follow
+// the gitignore rules: "#" starts a comment, "!" negates a pattern,
+// a trailing "/" makes a pattern match only dirs, a pattern with a
+// "/" at its start or in its middle matches relative to the dir of
+// the ignore file, and any other pattern matches at any level below
+// it. The last pattern that matches decides.
+// .
+type DirTreeOptions struct {
+	// NewNord makes the (unlinked) Norder for a disk item, such as
+	// a struct that embeds a Nord. Its Nord's paths and flags are
+	// then set by the caller. If nil, a plain [*Nord] is made.
+	NewNord func(absPath string, d fs.DirEntry) (Norder, error)
+	// Symlinks says what to do with symlinks.
+	Symlinks SymlinkMode
+	// Include, if not empty, keeps only the files whose relPath
+	// matches at least one of these doublestar globs (such as
+	// "**/*.md"). It does not apply to dirs, which are kept even
+	// if they end up with no kids.
+	Include []string
+	// Exclude prunes the files and dirs whose relPath matches any
+	// of these doublestar globs (such as "**/node_modules"). A
+	// pruned dir is never read.
+	Exclude []string
+	// MaxDepth, if > 0, is the lowest level of Nords. Dirs at
+	// that level are not read, and so have no kids.
+	MaxDepth int
+	// Hidden says what to do with items whose names start with ".".
+	Hidden HiddenMode
+	// IgnoreFiles says to honor any .gitignore and .ignore
+	// files in the tree, as described above.
+	IgnoreFiles bool
+	// Order, if not nil, returns the order for a Nord's kids (see
+	// [KidCmp]). It is called for each Nord whose kids are sorted,
+	// so that (for example) [ByOrderFile] reads the order file each
+	// time. If Order is nil, kids are in lexical order.
+	Order func() KidCmp
+	// IDs says to give the tree IDs (see [AssignIDs]).
+	IDs bool
+}
+
+// SymlinkMode says what [NewDirTree] and [ReconcileWith] do with
+// a symlink.
+type SymlinkMode int
+
+const (
+	// SymlinkRecord makes a leaf Nord for a symlink, which
+	// has its target (see [Nord.LinkTarget]) and knows if
+	// the target is a dir (see [Nord.IsDirlike]).
+	SymlinkRecord SymlinkMode = iota
+	// SymlinkFollow treats a symlink to a dir as a dir, so its
+	// Nord gets kids (and IsDir is true), but it is recorded
+	// instead if following it would loop, i.e. if its target
+	// is the dir of the link or one of its ancestors (compared
+	// by device and inode, using [os.SameFile]). A symlink to
+	// anything else is recorded.
+	SymlinkFollow
+	// SymlinkSkip leaves symlinks out of the tree.
+	SymlinkSkip
+)
+
+func (o *DirTreeOptions) symlinks() SymlinkMode {
+	if o == nil {
+		return SymlinkRecord
+	}
+	return o.Symlinks
+}
+
+func (o *DirTreeOptions) newNord(absPath string, d fs.DirEntry) (Norder, error) {
+	if o == nil || o.NewNord == nil {
+		return new(Nord), nil
+	}
+	return o.NewNord(absPath, d)
+}
+
+// NewDirTree reads the directory at rootPath recursively, and returns
+// a tree of Nords for it, with kids in lexical order (as returned by
+// [os.ReadDir]) unless the options have an Order. It also sets the
+// root path of the global [NordEng], as is expected by [NewNord].
+//
+// The root's relPath (like its absPath) is the absolute path of the
+// directory, and any other Nord's relPath is relative to it.
+// .
+func NewDirTree(rootPath string, opts *DirTreeOptions) (Norder, error) {
+	sc, e := newDirScan(opts)
+	if e != nil {
+		return nil, fmt.Errorf("NewDirTree: %w", e)
+	}
+	root, e := sc.newDirRoot(rootPath)
+	if e != nil {
+		return nil, fmt.Errorf("NewDirTree: %w", e)
+	}
+	if e := sc.addDirKids(root); e != nil {
+		return root, fmt.Errorf("NewDirTree: %w", e)
+	}
+	return root, nil
+}
+
+// newDirRoot makes the root Nord for the directory at rootPath
+// (without its kids), and sets the root path of [NordEng].
+func (sc *dirScan) newDirRoot(rootPath string) (Norder, error) {
+	absPath := FU.EnsureTrailingPathSep(FU.AbsFP(FP.Clean(rootPath)).S())
+	fi, e := os.Stat(absPath)
+	if e != nil {
+		return nil, e
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("not a dir: %s", absPath)
+	}
+	root, e := sc.newNord(absPath, fs.FileInfoToDirEntry(fi), true)
+	if e != nil {
+		return nil, e
+	}
+	p := root.nord()
+	p.relPath = absPath
+	p.absPath = FU.AbsFilePath(absPath)
+	p.isRoot = true
+	p.isDir = true
+	p.lineSummaryFunc = NordEng.summaryString
+	NordEng.rootPath = absPath
+	if sc.opts != nil && sc.opts.IDs {
+		if e := AssignIDs(root); e != nil {
+			return nil, e
+		}
+	}
+	return root, nil
+}
+
+// dirItem is a disk item as it goes in the tree.
+type dirItem struct {
+	d      fs.DirEntry
+	isDir  bool
+	target string
+	// targetIsDir is for a symlink.
+	targetIsDir bool
+}
+
+// resolve returns the dirItem for d, which is in par's directory.
+func (o *DirTreeOptions) resolve(par Norder, d fs.DirEntry) dirItem {
+	var it = dirItem{d: d, isDir: d.IsDir()}
+	if d.Type()&fs.ModeSymlink == 0 {
+		return it
+	}
+	path := FP.Join(par.AbsFP(), d.Name())
+	it.target, _ = os.Readlink(path)
+	fi, e := os.Stat(path)
+	if e != nil {
+		// A broken link.
+		return it
+	}
+	it.targetIsDir = fi.IsDir()
+	if o.symlinks() == SymlinkFollow && fi.IsDir() {
+		if linkLoops(par, fi) {
+			L.L.Warning("not following symlink <%s>, "+
+				"because it loops", path)
+		} else {
+			it.isDir = true
+		}
+	}
+	return it
+}
+
+// linkLoops is true if the dir fi is par's dir or an ancestor's.
+func linkLoops(par Norder, fi fs.FileInfo) bool {
+	for n := par; n != nil; n = n.Parent() {
+		if afi, e := os.Stat(n.AbsFP()); e == nil && os.SameFile(afi, fi) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches is true if the Nord k is (still) right for the item.
+func (it dirItem) matches(k Norder) bool {
+	return it.isDir == k.IsDir() && it.target == k.LinkTarget()
+}
+
+// newDirKid makes the Nord for the disk item in the directory of
+// par, with its paths and flags set, and links it in before the kid
+// before (or at the end if before is nil).
+func (sc *dirScan) newDirKid(par Norder, it dirItem, before Norder) (Norder, error) {
+	absPath := FP.Join(par.AbsFP(), it.d.Name())
+	if it.isDir {
+		absPath = FU.EnsureTrailingPathSep(absPath)
+	}
+	kid, e := sc.newNord(absPath, it.d, it.isDir)
+	if e != nil {
+		return nil, e
+	}
+	p := kid.nord()
+	p.relPath = kidRelPath(par, it.d.Name())
+	p.absPath = FU.AbsFilePath(absPath)
+	p.isDir = it.isDir
+	p.linkTarget = it.target
+	p.linkToDir = it.targetIsDir
+	p.lineSummaryFunc = NordEng.summaryString
+	insertKidBefore(par, kid, before)
+	return kid, nil
+}
+
+// addDirKids reads the directory of par, and adds a kid (and its
+// subtree) for each item in it. Errors reading subdirectories do
+// not stop it, and are all returned (joined).
+func (sc *dirScan) addDirKids(par Norder) error {
+	items, e := sc.readDir(par)
+	if e != nil {
+		return e
+	}
+	if sc.opts != nil && sc.opts.Order != nil {
+		defer par.nord().SortKids(sc.opts.Order())
+	}
+	var ee []error
+	for _, it := range items {
+		kid, e := sc.newDirKid(par, it, nil)
+		if e != nil {
+			ee = append(ee, e)
+			continue
+		}
+		if it.isDir && !sc.lazy {
+			if e := sc.addDirKids(kid); e != nil {
+				ee = append(ee, e)
+			}
+		}
+	}
+	return errors.Join(ee...)
+}
+
+// Changes lists what [Reconcile] changed in a tree. Added and Removed
+// list only the top of each added or removed subtree.
+type Changes struct {
+	Added    []Norder
+	Removed  []Norder
+	Modified []Norder
+}
+
+// IsEmpty is true if nothing changed.
+func (c Changes) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Modified) == 0
+}
+
+// Reconcile is [ReconcileWith] with default options.
+func Reconcile(root Norder) (Changes, error) {
+	return ReconcileWith(root, nil)
+}
+
+// ReconcileWith brings a tree built from a directory (such as by
+// [NewDirTree]) up to date with the disk, by re-reading each
+// directory under root.AbsFP():
+//   - A new item gets a new Nord (plus its subtree, for a directory),
+//     inserted among its siblings at its lexical position (which
+//     assumes that the siblings are in lexical order), or if there
+//     is an Order, the siblings are then sorted.
+//   - A Nord whose item has vanished is unlinked, with its subtree.
+//   - An item that has changed from file to directory (or vice versa),
+//     or a symlink whose target has changed, is treated as removed and
+//     then added.
+//   - A Nord whose item's size or modification time has changed is
+//     reported as modified. This works only for a Nord that carries
+//     file info, i.e. that has a method `DirEntryInfo() fs.FileInfo`
+//     (as [fileutils.FSItem] does). Its file info is updated only if
+//     it is a [FilePropsNord] (which also drops its cached contents);
+//     otherwise that is up to the caller.
+//
+// Unchanged Nords are kept as-is, so references to them stay valid.
+// For a tree of [LazyDirNord]s, opts is ignored (the tree's own are
+// used), and directories that are not expanded are skipped. If opts
+// has no NewNord, new Nords are of the same type as root, which must
+// be a [*Nord] or a [*FilePropsNord] (else it is an error).
+// An error reading a directory does not stop the reconciliation (and
+// that directory's Nords are kept); all errors are returned, joined.
+// .
+func ReconcileWith(root Norder, opts *DirTreeOptions) (Changes, error) {
+	var c Changes
+	if root == nil {
+		return c, errors.New("Reconcile: nil root")
+	}
+	sc, e := dirScanFor(root, opts)
+	if e == nil {
+		e = c.reconcileDir(root, sc, true)
+	}
+	if e != nil {
+		e = fmt.Errorf("Reconcile: %w", e)
+	}
+	return c, e
+}
+
+// reconcileOptions returns opts, but if it has no NewNord, with the
+// NewNord that makes new Nords of the same type as root, which is
+// known only for a [*Nord] and a [*FilePropsNord].
+func reconcileOptions(root Norder, opts *DirTreeOptions) (*DirTreeOptions, error) {
+	if opts != nil && opts.NewNord != nil {
+		return opts, nil
+	}
+	switch root.(type) {
+	case *Nord:
+		return opts, nil
+	case *FilePropsNord:
+		var fo FilePropsOptions
+		if opts != nil {
+			fo.DirTreeOptions = *opts
+		}
+		return fo.TreeOptions(), nil
+	}
+	return nil, fmt.Errorf("no NewNord in the options, "+
+		"to make new Nords of type %T", root)
+}
+
+// reconcileDir reconciles the kids of par with its directory, and
+// if deep, does the same for each subdirectory that is not new.
+func (c *Changes) reconcileDir(par Norder, sc *dirScan, deep bool) error {
+	if !dirIsRead(par) {
+		// Its kids are read when they are needed.
+		return nil
+	}
+	items, e := sc.readDir(par)
+	if e != nil {
+		return e
+	}
+	var onDisk = make(map[string]dirItem, len(items))
+	for _, it := range items {
+		onDisk[it.d.Name()] = it
+	}
+	// Remove vanished Nords (and ones that changed type).
+	var byName = make(map[string]Norder)
+	var g loopGuard
+	for k := par.FirstKid(); k != nil; {
+		if g.loops(k) {
+			return kidLoopError("Reconcile", par, k)
+		}
+		next := k.NextKid()
+		name := NordDirEntry{k}.Name()
+		if it, ok := onDisk[name]; !ok || !it.matches(k) {
+			removeKid(par, k)
+			c.Removed = append(c.Removed, k)
+		} else {
+			byName[name] = k
+		}
+		k = next
+	}
+	// Merge. before is where a new item goes: just
+	// after the Nord for the previous item on disk.
+	// With another Order, the kids are sorted after.
+	var added bool
+	var ee []error
+	var before = par.FirstKid()
+	for _, it := range items {
+		if k, ok := byName[it.d.Name()]; ok {
+			before = k.NextKid()
+			if isModified(k, it.d) {
+				c.Modified = append(c.Modified, k)
+				fi, _ := it.d.Info()
+				refreshNordInfo(k, fi)
+			}
+			if deep && k.IsDir() {
+				if e := c.reconcileDir(k, sc, true); e != nil {
+					ee = append(ee, e)
+				}
+			}
+			continue
+		}
+		kid, e := sc.newDirKid(par, it, before)
+		if e != nil {
+			ee = append(ee, e)
+			continue
+		}
+		c.Added = append(c.Added, kid)
+		added = true
+		if it.isDir && !sc.lazy {
+			if e := sc.addDirKids(kid); e != nil {
+				ee = append(ee, e)
+			}
+		}
+	}
+	if added && sc.opts != nil && sc.opts.Order != nil {
+		par.nord().SortKids(sc.opts.Order())
+	}
+	return errors.Join(ee...)
+}
+
+// isModified is true if k has file info, and
+// d's size or modification time is different.
+func isModified(k Norder, d fs.DirEntry) bool {
+	old := nordFileInfo(k)
+	if old == nil {
+		return false
+	}
+	fi, e := d.Info()
+	if e != nil {
+		// It vanished just now.
+		return true
+	}
+	return fi.Size() != old.Size() || !fi.ModTime().Equal(old.ModTime())
+}
+
+// refreshNordInfo is called when k's file is modified. It drops
+// k's cached digests, and updates its file info to fi, if k has
+// any (like a [FilePropsNord]) and fi is not nil.
+func refreshNordInfo(k Norder, fi fs.FileInfo) {
+	k.nord().dropDigests()
+	if r, ok := k.(interface{ refreshInfo(fs.FileInfo) }); ok && fi != nil {
+		r.refreshInfo(fi)
+	}
+}
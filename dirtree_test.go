@@ -0,0 +1,121 @@
+package orderednodes
+
+import (
+	"io/fs"
+	"os"
+	FP "path/filepath"
+	"slices"
+	"testing"
+)
+
+// kidNames lists the names of p's kids, in order.
+func kidNames(p Norder) []string {
+	var names []string
+	for k := p.FirstKid(); k != nil; k = k.NextKid() {
+		names = append(names, kidName(k))
+	}
+	return names
+}
+
+// relFPs lists the relPaths of nn.
+func relFPs(nn []Norder) []string {
+	var out []string
+	for _, n := range nn {
+		out = append(out, n.RelFP())
+	}
+	return out
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		change func(dir string) error
+		// added, removed and modified are relPaths,
+		// and kids are the names of the root's kids.
+		added, removed, modified, kids []string
+	}{
+		{"insert", map[string]string{"a": "1", "c": "3"},
+			func(d string) error {
+				return os.WriteFile(FP.Join(d, "b"), []byte("2"), 0644)
+			},
+			[]string{"b"}, nil, nil, []string{"a", "b", "c"}},
+		{"remove", map[string]string{"a": "1", "d/x": "2"},
+			func(d string) error {
+				return os.RemoveAll(FP.Join(d, "d"))
+			},
+			nil, []string{"d"}, nil, []string{"a"}},
+		{"modify", map[string]string{"a": "1", "b": "2"},
+			func(d string) error {
+				return os.WriteFile(FP.Join(d, "b"), []byte("22"), 0644)
+			},
+			nil, nil, []string{"b"}, []string{"a", "b"}},
+		{"file to dir", map[string]string{"a": "1", "b": "2"},
+			func(d string) error {
+				if e := os.Remove(FP.Join(d, "a")); e != nil {
+					return e
+				}
+				return os.MkdirAll(FP.Join(d, "a", "x"), 0755)
+			},
+			[]string{"a"}, []string{"a"}, nil, []string{"a", "b"}},
+		{"nothing", map[string]string{"a": "1"},
+			func(string) error { return nil },
+			nil, nil, nil, []string{"a"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := digestTestDir(t, tc.files)
+			// A FilePropsNord tree, reconciled without options,
+			// which must still make FilePropsNords.
+			r, e := NewFilePropsTree(d, nil)
+			if e != nil {
+				t.Fatal(e)
+			}
+			if e := tc.change(d); e != nil {
+				t.Fatal(e)
+			}
+			c, e := Reconcile(r)
+			if e != nil {
+				t.Fatal(e)
+			}
+			for _, x := range []struct {
+				what      string
+				got, want []string
+			}{
+				{"added", relFPs(c.Added), tc.added},
+				{"removed", relFPs(c.Removed), tc.removed},
+				{"modified", relFPs(c.Modified), tc.modified},
+				{"kids", kidNames(r), tc.kids},
+			} {
+				if !slices.Equal(x.got, x.want) {
+					t.Errorf("%s: got %q, want %q", x.what, x.got, x.want)
+				}
+			}
+			for _, a := range c.Added {
+				InspectTree(a, func(n Norder) error {
+					if _, ok := n.(*FilePropsNord); !ok {
+						t.Errorf("<%s> is a %T", n.RelFP(), n)
+					}
+					return nil
+				})
+			}
+		})
+	}
+}
+
+// testDirNord is a Norder type that Reconcile does not know.
+type testDirNord struct{ Nord }
+
+func TestReconcileUnknownType(t *testing.T) {
+	d := digestTestDir(t, map[string]string{"a": "1"})
+	r, e := NewDirTree(d, &DirTreeOptions{
+		NewNord: func(string, fs.DirEntry) (Norder, error) {
+			return new(testDirNord), nil
+		}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := Reconcile(r); e == nil {
+		t.Errorf("no error for a tree of %T without NewNord", r)
+	}
+}
@@ -0,0 +1,94 @@
+package orderednodes
+
+import (
+	"bytes"
+	"slices"
+	S "strings"
+	"testing"
+)
+
+func TestDitaMapRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		title string
+		dump  []string
+		// keep is what must be written back.
+		keep []string
+	}{
+		{"map", `<map><title>The <ph>Top</ph> Map</title>
+  <topicref href="a.dita" navtitle="A">
+    <topicref href="b.dita#x" scope="local"/>
+  </topicref>
+  <topichead navtitle="Head"><topicref href="c.dita"/></topichead>
+</map>`, "The Top Map", []string{
+			"A|a.dita",
+			"  |b.dita#x",
+			"Head|",
+			"  |c.dita",
+		}, []string{`scope="local"`}},
+		{"topicmeta", `<map>
+  <topicref href="a.dita">
+    <topicmeta><navtitle>A <b>nav</b></navtitle><shortdesc>Short <i>desc</i></shortdesc></topicmeta>
+  </topicref>
+</map>`, "", []string{
+			"A nav|a.dita",
+		}, []string{
+			"<topicmeta><navtitle>A <b>nav</b></navtitle>" +
+				"<shortdesc>Short <i>desc</i></shortdesc></topicmeta>",
+		}},
+		{"reltable and data", `<map>
+  <topicref href="a.dita"><data name="d" value="1"/></topicref>
+  <reltable><relrow><relcell><topicref href="a.dita"/></relcell></relrow></reltable>
+</map>`, "", []string{
+			"|a.dita",
+		}, []string{
+			`<data name="d" value="1"/>`,
+			`<reltable><relrow><relcell><topicref href="a.dita"/></relcell></relrow></reltable>`,
+		}},
+		{"bookmap", `<bookmap>
+  <booktitle><booklibrary>L</booklibrary><mainbooktitle>The Book</mainbooktitle></booktitle>
+  <chapter href="c1.dita"/>
+</bookmap>`, "The Book", []string{
+			"|c1.dita",
+		}, []string{"<mainbooktitle>The Book</mainbooktitle>"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, e := ReadDitaMapFrom(S.NewReader(tc.src), "/d/m.ditamap")
+			if e != nil {
+				t.Fatal(e)
+			}
+			var buf bytes.Buffer
+			if e := WriteDitaMap(&buf, r); e != nil {
+				t.Fatal(e)
+			}
+			out := buf.String()
+			for _, s := range tc.keep {
+				if !S.Contains(out, s) {
+					t.Errorf("%q is not in the output:\n%s", s, out)
+				}
+			}
+			r2, e := ReadDitaMapFrom(&buf, "/d/m.ditamap")
+			if e != nil {
+				t.Fatal(e)
+			}
+			for i, rr := range []*TocNord{r, r2} {
+				if rr.Title != tc.title {
+					t.Errorf("read %d: title %q, want %q", i, rr.Title, tc.title)
+				}
+				if got := outlineDump(rr); !slices.Equal(got, tc.dump) {
+					t.Errorf("read %d: got %q, want %q", i, got, tc.dump)
+				}
+			}
+			// And writing it again changes nothing.
+			var buf2 bytes.Buffer
+			if e := WriteDitaMap(&buf2, r2); e != nil {
+				t.Fatal(e)
+			}
+			if buf2.String() != out {
+				t.Errorf("second write:\n%s\nfirst write:\n%s", buf2.String(), out)
+			}
+		})
+	}
+}
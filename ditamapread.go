@@ -0,0 +1,316 @@
+package orderednodes
+
+// This file reads DITA maps (".ditamap", including bookmaps and LwDITA
+// XDITA maps, which use the same elements) into trees of [*TocNord].
+// The ToC structure is parsed: the entries are the elements topicref,
+// topichead, topicgroup, mapref and keydef (and any specialization of
+// topicref that declares its @class), in document order. An entry's
+// <topicmeta>, and any other elements in it (like a <reltable> in the
+// map, or <data>), are kept as raw XML, so that they can be written
+// back (see [TocNord]).
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	FP "path/filepath"
+	S "strings"
+
+	FU "github.com/fbaube/fileutils"
+)
+
+// ErrDitaMapCycle is wrapped by the error returned when a
+// mapref refers (directly or indirectly) to its own map.
+var ErrDitaMapCycle = errors.New("DITA map includes itself")
+
+// ditaEntryTags are the elements that become entries.
+var ditaEntryTags = map[string]bool{
+	"topicref": true, "topichead": true, "topicgroup": true,
+	"mapref": true, "keydef": true,
+	// Bookmap elements, for maps that are read without their DTD
+	"part": true, "chapter": true, "appendices": true, "appendix": true,
+}
+
+// ditaEntry is an entry as parsed, before we make a Nord of it,
+// because the title might appear (in <topicmeta><navtitle>)
+// only after the entry's own start tag.
+type ditaEntry struct {
+	tag   string
+	title string
+	href  string
+	attrs []xml.Attr
+	kids  []*ditaEntry
+	// meta and rest are raw XML, as for [TocNord].
+	meta string
+	rest []string
+}
+
+// ReadDitaMap reads the DITA map at mapPath and returns it as a tree
+// of [*TocNord]. Each relative href is resolved (w.r.t. the map that
+// it is in) into the entry's [Nord.AbsFP]. Each mapref (i.e. any entry
+// with format="ditamap") is expanded, by reading the referenced map
+// and adding its entries as kids of the mapref; a cycle of maprefs
+// returns an error that wraps [ErrDitaMapCycle].
+// .
+func ReadDitaMap(mapPath string) (*TocNord, error) {
+	f, e := os.Open(mapPath)
+	if e != nil {
+		return nil, fmt.Errorf("ReadDitaMap: %w", e)
+	}
+	defer f.Close()
+	return ReadDitaMapFrom(f, mapPath)
+}
+
+// ReadDitaMapFrom is like [ReadDitaMap], but it reads the top-level
+// map from r; mapPath is used to resolve hrefs and maprefs.
+func ReadDitaMapFrom(r io.Reader, mapPath string) (*TocNord, error) {
+	rootEnt, e := parseDitaMap(r)
+	if e != nil {
+		return nil, fmt.Errorf("ReadDitaMap <%s>: %w", mapPath, e)
+	}
+	root := NewRootTocNord(mapPath)
+	root.Tag = rootEnt.tag
+	root.Title = rootEnt.title
+	root.Attrs = rootEnt.attrs
+	root.Meta = rootEnt.meta
+	root.Rest = rootEnt.rest
+	var inProgress = []string{root.AbsFP()}
+	if e = addDitaEntries(root, rootEnt.kids, mapPath, inProgress); e != nil {
+		return nil, fmt.Errorf("ReadDitaMap <%s>: %w", mapPath, e)
+	}
+	return root, nil
+}
+
+// addDitaEntries makes Nords of entries and adds them to par. Any
+// mapref is expanded; inProgress are the maps that are being read,
+// outermost first, for detecting cycles.
+func addDitaEntries(par Norder, entries []*ditaEntry, mapPath string, inProgress []string) error {
+	for _, ent := range entries {
+		kid := NewTocNord(par, ent.title, ent.href, mapPath)
+		kid.Tag = ent.tag
+		kid.Attrs = ent.attrs
+		kid.Meta = ent.meta
+		kid.Rest = ent.rest
+		// External targets are not files.
+		if kid.Attr("scope") == "external" {
+			kid.absPath = FU.AbsFP(FP.Clean(mapPath))
+		}
+		par.AddKid(kid)
+		if e := addDitaEntries(kid, ent.kids, mapPath, inProgress); e != nil {
+			return e
+		}
+		if !isDitaMapref(kid) {
+			continue
+		}
+		subPath := kid.AbsFP()
+		for _, s := range inProgress {
+			if s == subPath {
+				return fmt.Errorf("%w: %s", ErrDitaMapCycle,
+					S.Join(append(inProgress, subPath), " -> "))
+			}
+		}
+		f, e := os.Open(subPath)
+		if e != nil {
+			return e
+		}
+		subEnt, e := parseDitaMap(f)
+		f.Close()
+		if e != nil {
+			return fmt.Errorf("mapref <%s>: %w", subPath, e)
+		}
+		// Note that the slice is copied when it grows.
+		e = addDitaEntries(kid, subEnt.kids, subPath,
+			append(inProgress[:len(inProgress):len(inProgress)], subPath))
+		if e != nil {
+			return e
+		}
+		kid.Expanded = true
+	}
+	return nil
+}
+
+// isDitaMapref is true for a local entry that refers to another map.
+func isDitaMapref(p *TocNord) bool {
+	if _, ok := tocLocalPath(p.Href); !ok || p.Attr("scope") == "external" {
+		return false
+	}
+	return p.Tag == "mapref" || p.Attr("format") == "ditamap"
+}
+
+// parseDitaMap returns the root element of a map as an entry.
+func parseDitaMap(r io.Reader) (*ditaEntry, error) {
+	// The source is kept, for the raw XML of what is not parsed.
+	src, e := io.ReadAll(r)
+	if e != nil {
+		return nil, e
+	}
+	var root *ditaEntry
+	var stack []*ditaEntry
+	// skipDepth > 0 when we are inside an element that we do not
+	// parse, which starts at skipStart, and which is kept as raw
+	// XML if skipKeep (i.e. unless it is in something else that is
+	// kept or ignored).
+	var skipDepth int
+	var skipStart int64
+	var skipKeep bool
+	// inMeta and inTitle track <topicmeta>, and <navtitle> in it
+	// or the map's own <title>, whose text we want.
+	var inMeta, inTitle bool
+	var metaStart int64
+	// inBookTitle tracks a bookmap's <booktitle>, in
+	// which we want the text of the <mainbooktitle>.
+	var inBookTitle bool
+	var title S.Builder
+	dec := xml.NewDecoder(bytes.NewReader(src))
+	// Maps are normally UTF-8, but be tolerant.
+	dec.CharsetReader = func(cs string, in io.Reader) (io.Reader, error) {
+		return in, nil
+	}
+	dec.Strict = false
+	for {
+		// A token starts where the previous one ended.
+		start := dec.InputOffset()
+		tok, e := dec.Token()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return nil, e
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if skipDepth > 0 {
+				skipDepth++
+				continue
+			}
+			if root == nil {
+				root = newDitaEntry(t)
+				stack = append(stack, root)
+				continue
+			}
+			top := stack[len(stack)-1]
+			switch {
+			case inTitle:
+				// Markup in a title (like <ph>): keep its text.
+			case inMeta:
+				if name == "navtitle" {
+					inTitle = true
+					title.Reset()
+				} else {
+					skipDepth, skipKeep = 1, false
+				}
+			case inBookTitle:
+				if name == "mainbooktitle" {
+					inTitle = true
+					title.Reset()
+				} else {
+					skipDepth, skipKeep = 1, false
+				}
+			case name == "topicmeta":
+				inMeta = true
+				metaStart = start
+			case name == "booktitle" && top == root:
+				inBookTitle = true
+			case name == "title" && top == root:
+				inTitle = true
+				title.Reset()
+			case ditaEntryTags[name] || isDitaTopicrefClass(t):
+				ent := newDitaEntry(t)
+				top.kids = append(top.kids, ent)
+				stack = append(stack, ent)
+			default:
+				// reltable, data, ditavalref, etc.
+				skipDepth, skipStart, skipKeep = 1, start, true
+			}
+		case xml.EndElement:
+			name := t.Name.Local
+			if len(stack) == 0 {
+				continue
+			}
+			top := stack[len(stack)-1]
+			if skipDepth > 0 {
+				skipDepth--
+				if skipDepth == 0 && skipKeep {
+					top.rest = append(top.rest,
+						string(src[skipStart:dec.InputOffset()]))
+				}
+				continue
+			}
+			switch {
+			case inTitle && (name == "navtitle" || name == "title" ||
+				name == "mainbooktitle"):
+				inTitle = false
+				if s := S.Join(S.Fields(title.String()), " "); s != "" {
+					top.title = s
+				}
+			case inTitle:
+				// end of markup inside a title
+			case inMeta && name == "topicmeta":
+				inMeta = false
+				top.meta = string(src[metaStart:dec.InputOffset()])
+			case inBookTitle && name == "booktitle":
+				inBookTitle = false
+			default:
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if inTitle && skipDepth == 0 {
+				title.Write(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no root element")
+	}
+	if root.tag != "map" && root.tag != "bookmap" &&
+		!S.Contains(root.attr("class"), " map/map ") {
+		return nil, fmt.Errorf("root element is <%s>, not <map>", root.tag)
+	}
+	return root, nil
+}
+
+// newDitaEntry keeps href and navtitle apart from the other
+// attributes. A navtitle element (if any) overrides the attribute.
+func newDitaEntry(t xml.StartElement) *ditaEntry {
+	ent := &ditaEntry{tag: t.Name.Local}
+	for _, a := range t.Attr {
+		switch a.Name.Local {
+		case "href":
+			ent.href = a.Value
+		case "navtitle":
+			ent.title = a.Value
+		case "title":
+			if t.Name.Local == "map" || t.Name.Local == "bookmap" {
+				ent.title = a.Value
+			} else {
+				ent.attrs = append(ent.attrs, a)
+			}
+		default:
+			ent.attrs = append(ent.attrs, a)
+		}
+	}
+	return ent
+}
+
+func (p *ditaEntry) attr(name string) string {
+	for _, a := range p.attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// isDitaTopicrefClass catches specializations like <chapter>.
+func isDitaTopicrefClass(t xml.StartElement) bool {
+	for _, a := range t.Attr {
+		if a.Name.Local == "class" {
+			return S.Contains(a.Value, " map/topicref ")
+		}
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package orderednodes
+
+// This file writes trees of Norders out as DITA maps, in three
+// flavors: a DITA (or XDITA) ".ditamap", an LwDITA MDITA map (a
+// Markdown document with nested lists of links), and an LwDITA HDITA
+// map (an HTML5 document with a <nav> of nested lists of links).
+//
+// Entries that are [*TocNord] keep their element names and attributes
+// (navtitle, format, scope, keys, etc.) as read by [ReadDitaMap], and
+// in a .ditamap, their <topicmeta> and other elements (like a map's
+// <reltable>), which are written as they were read, with the other
+// elements after the kids; any other Norder becomes a topicref (or a
+// topichead, if it is a dir).
+// The kids of an expanded mapref are not written, because they live
+// in the map that the mapref refers to (and each mapref whose kids
+// are left out is logged, at level Info).
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	S "strings"
+
+	L "github.com/fbaube/mlog"
+)
+
+const xmlNamespaceURL = "http://www.w3.org/XML/1998/namespace"
+
+// WriteDitaMap writes the tree under root as a ".ditamap", with
+// a DOCTYPE that is chosen by the root's Tag ("map" or "bookmap").
+// The root's title is a <title>, or for a bookmap, a <booktitle>
+// with a <mainbooktitle>. The kids of an expanded mapref (see
+// [TocNord]) are not written.
+func WriteDitaMap(w io.Writer, root Norder) error {
+	bw := bufio.NewWriter(w)
+	tag, title, _ := ditaTagTitleHref(root)
+	if tag == "" || tag == "topicref" || tag == "topichead" {
+		tag = "map"
+	}
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	switch tag {
+	case "map":
+		bw.WriteString(`<!DOCTYPE map PUBLIC "-//OASIS//DTD DITA Map//EN" "map.dtd">` + "\n")
+	case "bookmap":
+		bw.WriteString(`<!DOCTYPE bookmap PUBLIC "-//OASIS//DTD DITA BookMap//EN" "bookmap.dtd">` + "\n")
+	}
+	// Namespace prefixes declared on the root, by URL,
+	// so that prefixed attributes are written as read.
+	var prefixes = map[string]string{xmlNamespaceURL: "xml"}
+	var rootAttrs []xml.Attr
+	var meta string
+	var rest []string
+	if tn, ok := root.(*TocNord); ok {
+		rootAttrs, meta, rest = tn.Attrs, tn.Meta, tn.Rest
+		for _, a := range tn.Attrs {
+			if a.Name.Space == "xmlns" {
+				prefixes[a.Value] = a.Name.Local
+			}
+		}
+	}
+	bw.WriteString("<" + tag + ditaAttrsString(rootAttrs, prefixes) + ">\n")
+	if title != "" && tag == "bookmap" {
+		bw.WriteString("  <booktitle>\n    <mainbooktitle>" +
+			xmlEscape(title) + "</mainbooktitle>\n  </booktitle>\n")
+	} else if title != "" {
+		bw.WriteString("  <title>" + xmlEscape(title) + "</title>\n")
+	}
+	writeDitaRaw(bw, "  ", meta)
+	writeDitaEntries(bw, root, 1, prefixes)
+	writeDitaRaw(bw, "  ", rest...)
+	bw.WriteString("</" + tag + ">\n")
+	if e := bw.Flush(); e != nil {
+		return fmt.Errorf("WriteDitaMap: %w", e)
+	}
+	return nil
+}
+
+func writeDitaEntries(w *bufio.Writer, par Norder, depth int, prefixes map[string]string) {
+	if isExpanded(par) {
+		reportExpanded("WriteDitaMap", par)
+		return
+	}
+	indent := S.Repeat("  ", depth)
+	for kid := par.FirstKid(); kid != nil; kid = kid.NextKid() {
+		tag, title, href := ditaTagTitleHref(kid)
+		var meta string
+		var rest []string
+		var sb S.Builder
+		sb.WriteString(indent + "<" + tag)
+		if href != "" {
+			sb.WriteString(` href="` + xmlEscape(href) + `"`)
+		}
+		tn, ok := kid.(*TocNord)
+		if ok {
+			meta, rest = tn.Meta, tn.Rest
+		}
+		if title != "" && !ditaMetaHasNavtitle(meta) {
+			sb.WriteString(` navtitle="` + xmlEscape(title) + `"`)
+		}
+		if ok {
+			sb.WriteString(ditaAttrsString(tn.Attrs, prefixes))
+		}
+		w.WriteString(sb.String())
+		hasKids := kid.HasKids() && !isExpanded(kid)
+		if !hasKids {
+			reportExpanded("WriteDitaMap", kid)
+		}
+		if !hasKids && meta == "" && len(rest) == 0 {
+			w.WriteString("/>\n")
+			continue
+		}
+		w.WriteString(">\n")
+		writeDitaRaw(w, indent+"  ", meta)
+		if hasKids {
+			writeDitaEntries(w, kid, depth+1, prefixes)
+		}
+		writeDitaRaw(w, indent+"  ", rest...)
+		w.WriteString(indent + "</" + tag + ">\n")
+	}
+}
+
+// writeDitaRaw writes each of raw (skipping any that is "") on a
+// line of its own. It is raw XML, so it keeps its own indentation
+// after its first line.
+func writeDitaRaw(w *bufio.Writer, indent string, raw ...string) {
+	for _, s := range raw {
+		if s != "" {
+			w.WriteString(indent + s + "\n")
+		}
+	}
+}
+
+// ditaMetaHasNavtitle is true if the raw <topicmeta>
+// meta has a <navtitle>, which overrides the attribute.
+func ditaMetaHasNavtitle(meta string) bool {
+	if meta == "" {
+		return false
+	}
+	dec := xml.NewDecoder(S.NewReader(meta))
+	dec.Strict = false
+	for {
+		tok, e := dec.Token()
+		if e != nil {
+			return false
+		}
+		if t, ok := tok.(xml.StartElement); ok && t.Name.Local == "navtitle" {
+			return true
+		}
+	}
+}
+
+// isExpanded is true for a mapref whose kids are from another map.
+func isExpanded(p Norder) bool {
+	tn, ok := p.(*TocNord)
+	return ok && tn.Expanded
+}
+
+// reportExpanded logs that the kids of p are not written,
+// if it is an expanded mapref that has kids.
+func reportExpanded(op string, p Norder) {
+	if !isExpanded(p) || !p.HasKids() {
+		return
+	}
+	L.L.Info("%s: not writing the %d kids of expanded mapref <%s>",
+		op, p.KidCount(), p.RelFP())
+}
+
+// WriteMditaMap writes the tree under root as an LwDITA MDITA map:
+// a Markdown document whose title is a level 1 heading, and whose
+// entries are (nested) list items that are links. An entry without
+// a target is plain text.
+// .
+func WriteMditaMap(w io.Writer, root Norder) error {
+	bw := bufio.NewWriter(w)
+	if _, title, _ := ditaTagTitleHref(root); title != "" {
+		bw.WriteString("# " + title + "\n\n")
+	}
+	writeMditaEntries(bw, root, 0)
+	if e := bw.Flush(); e != nil {
+		return fmt.Errorf("WriteMditaMap: %w", e)
+	}
+	return nil
+}
+
+func writeMditaEntries(w *bufio.Writer, par Norder, depth int) {
+	if isExpanded(par) {
+		reportExpanded("WriteMditaMap", par)
+		return
+	}
+	indent := S.Repeat("  ", depth)
+	for kid := par.FirstKid(); kid != nil; kid = kid.NextKid() {
+		_, title, href := ditaTagTitleHref(kid)
+		text := title
+		if text == "" {
+			text = TocLabel(title, href)
+		}
+		text = S.NewReplacer("[", `\[`, "]", `\]`).Replace(text)
+		if href == "" {
+			w.WriteString(indent + "- " + text + "\n")
+		} else {
+			if S.ContainsAny(href, " ()<>") {
+				href = "<" + href + ">"
+			}
+			w.WriteString(indent + "- [" + text + "](" + href + ")\n")
+		}
+		writeMditaEntries(w, kid, depth+1)
+	}
+}
+
+// WriteHditaMap writes the tree under root as an LwDITA HDITA map:
+// an HTML5 document with a <nav> whose title is an <h1>, and whose
+// entries are (nested) list items that are links. An entry without
+// a target is a paragraph.
+// .
+func WriteHditaMap(w io.Writer, root Norder) error {
+	bw := bufio.NewWriter(w)
+	_, title, _ := ditaTagTitleHref(root)
+	bw.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	bw.WriteString("<title>" + xmlEscape(title) + "</title>\n")
+	bw.WriteString("</head>\n<body>\n<nav>\n")
+	if title != "" {
+		bw.WriteString("<h1>" + xmlEscape(title) + "</h1>\n")
+	}
+	writeHditaEntries(bw, root, 0)
+	bw.WriteString("</nav>\n</body>\n</html>\n")
+	if e := bw.Flush(); e != nil {
+		return fmt.Errorf("WriteHditaMap: %w", e)
+	}
+	return nil
+}
+
+func writeHditaEntries(w *bufio.Writer, par Norder, depth int) {
+	if isExpanded(par) {
+		reportExpanded("WriteHditaMap", par)
+		return
+	}
+	if !par.HasKids() {
+		return
+	}
+	indent := S.Repeat("  ", depth)
+	w.WriteString(indent + "<ul>\n")
+	for kid := par.FirstKid(); kid != nil; kid = kid.NextKid() {
+		_, title, href := ditaTagTitleHref(kid)
+		text := title
+		if text == "" {
+			text = TocLabel(title, href)
+		}
+		if href == "" {
+			w.WriteString(indent + "<li><p>" + xmlEscape(text) + "</p>")
+		} else {
+			w.WriteString(indent + `<li><a href="` + xmlEscape(href) +
+				`">` + xmlEscape(text) + "</a>")
+		}
+		if kid.HasKids() && !isExpanded(kid) {
+			w.WriteString("\n")
+			writeHditaEntries(w, kid, depth+1)
+			w.WriteString(indent)
+		} else {
+			reportExpanded("WriteHditaMap", kid)
+		}
+		w.WriteString("</li>\n")
+	}
+	w.WriteString(indent + "</ul>\n")
+}
+
+// ditaTagTitleHref gets the element name, the title and the target of
+// any Norder. An entry that was not read from a map is a topichead if
+// it is a dir (or a title-only TocNord), else a topicref.
+func ditaTagTitleHref(p Norder) (tag, title, href string) {
+	title, href = tocTitleAndHref(p)
+	if tn, ok := p.(*TocNord); ok {
+		tag = tn.Tag
+	}
+	if tag == "" {
+		if href == "" {
+			tag = "topichead"
+		} else {
+			tag = "topicref"
+		}
+	}
+	return tag, title, href
+}
+
+// ditaAttrsString writes attributes, each with a leading space.
+func ditaAttrsString(attrs []xml.Attr, prefixes map[string]string) string {
+	var sb S.Builder
+	for _, a := range attrs {
+		name := a.Name.Local
+		if sp := a.Name.Space; sp != "" {
+			if pfx, ok := prefixes[sp]; ok {
+				sp = pfx
+			}
+			name = sp + ":" + name
+		}
+		sb.WriteString(" " + name + `="` + xmlEscape(a.Value) + `"`)
+	}
+	return sb.String()
+}
+
+func xmlEscape(s string) string {
+	var sb S.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
@@ -1,6 +1,6 @@
 // Package orderednodes is a way to create a hierarchical tree of nodes,
 // where the nodes are ordered and keep their order, and without needing
-// or using Go generics.
+// Go generics (although they can be used; see below).
 //
 // Node order is of course important for markup in general and XML mixed
 // content in particular, while unimportant when XML is used purely for
@@ -9,4 +9,9 @@
 // interface [Norder] is implemented not for type [Nord] but rather for
 // `*Nord´. NThis is so that nodes are writable. 
 //
+// Generics are optional: [Node] is a Nord with a typed payload and
+// typed navigation, for when embedding Nord in a struct (and then
+// using type assertions) is too clumsy. The iterators [Kids] and
+// [All] yield a given concrete type for any tree.
+//
 package orderednodes
@@ -1,6 +1,15 @@
 package orderednodes
 
 import (
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	FP "path/filepath"
+	"sync"
+
 	FU "github.com/fbaube/fileutils"
 )
 
@@ -16,10 +25,236 @@ import (
 // Also we can use fields of seqId's to store parent and kid seqId's,
 // adding yet another layer of error checking and simplified access.
 //
+// Make one with [NewFilePropsNord], or a whole tree of them with
+// [NewFilePropsTree]. The contents (see [FilePropsNord.Contents]) and
+// the MIME type (see [FilePropsNord.MIMEType]) are loaded lazily,
+// unless the options say otherwise.
+//
 type FilePropsNord struct {
 	Nord
 	FU.FSItem
+	// mimeType is "" until it is sniffed.
+	mimeType string
+	// contentHash is nil until it is computed.
+	contentHash *Digest
 }
 
 // Available to ensure that assignments to/from root node are explicit.
 type RootFilePropsNord FilePropsNord
+
+// IsDir is the Nord's (not the FSItem's), so it is also true
+// for a symlink to a dir that was followed (see [SymlinkFollow]).
+// It also resolves the ambiguity of the two embedded methods,
+// so that a *FilePropsNord is a [Norder].
+func (p *FilePropsNord) IsDir() bool {
+	return p.Nord.IsDir()
+}
+
+// IsDirlike is the Nord's, which (unlike the FSItem's)
+// is false for a symlink to something that is not a dir.
+func (p *FilePropsNord) IsDirlike() bool {
+	return p.Nord.IsDirlike()
+}
+
+// AddKid is [Nord.AddKid], except that the kid's parent
+// link is to p, so that its Parent is a *FilePropsNord.
+func (p *FilePropsNord) AddKid(k Norder) Norder {
+	return linkKid(p, k)
+}
+
+// AddKids is [Nord.AddKids], but using [FilePropsNord.AddKid].
+func (p *FilePropsNord) AddKids(kk []Norder) Norder {
+	linkKids(p, kk)
+	return p
+}
+
+// NewFilePropsNord expects a path like [NewNord] does (i.e. relative
+// to the root path of [NordEng]), and it stats the item at the path
+// (but does not follow a symlink), and sets the Nord's flags from
+// it. It does not load the contents. If nothing exists at the path,
+// the error wraps [fs.ErrNotExist].
+// .
+func NewFilePropsNord(aRelPath string) (*FilePropsNord, error) {
+	if aRelPath == "" {
+		return nil, fmt.Errorf("NewFilePropsNord: missing path")
+	}
+	p, e := newFilePropsNord(FP.Join(NordEng.rootPath, aRelPath))
+	if e != nil {
+		return nil, fmt.Errorf("NewFilePropsNord: %w", e)
+	}
+	p.relPath = aRelPath
+	p.lineSummaryFunc = NordEng.summaryString
+	return p, nil
+}
+
+// newFilePropsNord makes a FilePropsNord for the item at path,
+// with its absPath and its flags (but not its relPath) set.
+func newFilePropsNord(path string) (*FilePropsNord, error) {
+	fsi, e := FU.NewFSItem(path)
+	if e != nil {
+		return nil, e
+	}
+	if fsi == nil {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	p := &FilePropsNord{FSItem: *fsi}
+	p.absPath = FU.AbsFilePath(fsi.FPs.AbsFP)
+	p.isDir = fsi.FI.IsDir()
+	if fsi.IsSymlink() {
+		p.linkTarget, _ = os.Readlink(FU.StripTrailingPathSep(path))
+		if fi, e := os.Stat(path); e == nil {
+			p.linkToDir = fi.IsDir()
+		}
+	}
+	return p, nil
+}
+
+// FilePropsOptions configures [NewFilePropsTree].
+type FilePropsOptions struct {
+	// DirTreeOptions are as for [NewDirTree],
+	// except that NewNord is not used.
+	DirTreeOptions
+	// LoadContents says to load each file's contents when its
+	// Nord is made, rather than on first use. A file that cannot
+	// be read stops the build.
+	LoadContents bool
+	// SniffMIME says to sniff each file's MIME type
+	// when its Nord is made, rather than on first use.
+	SniffMIME bool
+}
+
+// NewFilePropsTree is [NewDirTree], but every Nord in the tree is a
+// *FilePropsNord with its FSItem fully set (except for the contents,
+// unless the options say to load them). A symlink that is followed
+// has the FSItem of the link, not of its target.
+//
+// To reconcile the tree (or watch it) with options that load the
+// contents or sniff the MIME type, use the options from
+// [FilePropsOptions.TreeOptions]. Without a NewNord in the options,
+// new Nords are still FilePropsNords (see [ReconcileWith]).
+// .
+func NewFilePropsTree(rootPath string, opts *FilePropsOptions) (*FilePropsNord, error) {
+	root, e := NewDirTree(rootPath, opts.TreeOptions())
+	if root == nil {
+		return nil, fmt.Errorf("NewFilePropsTree: %w", e)
+	}
+	p := root.(*FilePropsNord)
+	if e != nil {
+		return p, fmt.Errorf("NewFilePropsTree: %w", e)
+	}
+	return p, nil
+}
+
+// TreeOptions returns the [DirTreeOptions] that make FilePropsNords.
+// A nil *FilePropsOptions is the same as the zero value.
+func (o *FilePropsOptions) TreeOptions() *DirTreeOptions {
+	var fo FilePropsOptions
+	if o != nil {
+		fo = *o
+	}
+	var to = fo.DirTreeOptions
+	to.NewNord = func(absPath string, d fs.DirEntry) (Norder, error) {
+		p, e := newFilePropsNord(absPath)
+		if e != nil {
+			return nil, e
+		}
+		if fo.LoadContents && p.IsFile() {
+			if e := p.LoadContents(); e != nil {
+				return nil, e
+			}
+		}
+		if fo.SniffMIME {
+			p.MIMEType()
+		}
+		return p, nil
+	}
+	return &to
+}
+
+// propsMu guards the contents and MIME types that are loaded
+// lazily, because they are loaded by funcs that only read the
+// tree, and so by concurrent readers (as under [Watcher.RLock]).
+var propsMu sync.Mutex
+
+// Contents returns the contents of a file, loading them (using
+// [FU.FSItem.LoadContents]) if they are not loaded yet. For a
+// dir (or anything else that is not a file), they are empty.
+func (p *FilePropsNord) Contents() (string, error) {
+	propsMu.Lock()
+	defer propsMu.Unlock()
+	if p.TypedRaw == nil {
+		if e := p.LoadContents(); e != nil {
+			p.TypedRaw = nil
+			return "", fmt.Errorf("FilePropsNord.Contents: %w", e)
+		}
+	}
+	return p.Raw.S(), nil
+}
+
+// sniffLen is how much of a file [http.DetectContentType] uses.
+const sniffLen = 512
+
+// MIMEType returns the MIME type of a file, from its extension (as
+// per [mime.TypeByExtension]) if that is known, or else by sniffing
+// its contents (as per [http.DetectContentType]), reading only the
+// start of the file if the contents are not loaded. A dir is
+// "inode/directory", and a symlink is "inode/symlink". It returns
+// "" if the file cannot be read. The result is cached.
+// .
+func (p *FilePropsNord) MIMEType() string {
+	propsMu.Lock()
+	defer propsMu.Unlock()
+	if p.mimeType != "" {
+		return p.mimeType
+	}
+	switch {
+	case p.FI == nil:
+		return ""
+	case p.FI.IsDir():
+		p.mimeType = "inode/directory"
+	case p.IsSymlink():
+		p.mimeType = "inode/symlink"
+	default:
+		if t := mime.TypeByExtension(FP.Ext(p.absPath.S())); t != "" {
+			p.mimeType = t
+			break
+		}
+		head, e := p.head()
+		if e != nil {
+			return ""
+		}
+		p.mimeType = http.DetectContentType(head)
+	}
+	return p.mimeType
+}
+
+// head returns the start of the contents,
+// without loading them if they are not loaded.
+func (p *FilePropsNord) head() ([]byte, error) {
+	if p.TypedRaw != nil {
+		s := p.Raw.S()
+		return []byte(s[:min(len(s), sniffLen)]), nil
+	}
+	f, e := os.Open(p.absPath.S())
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+	var buf = make([]byte, sniffLen)
+	n, e := io.ReadFull(f, buf)
+	if e != nil && e != io.EOF && e != io.ErrUnexpectedEOF {
+		return nil, e
+	}
+	return buf[:n], nil
+}
+
+// refreshInfo is called by [Reconcile] when the file is modified.
+// It updates the file info, and drops the contents, MIME type
+// and hashes.
+func (p *FilePropsNord) refreshInfo(fi fs.FileInfo) {
+	p.FI = fi
+	p.TypedRaw = nil
+	p.mimeType = ""
+	p.contentHash = nil
+	p.dropDigests()
+}
@@ -5,8 +5,12 @@ go 1.23
 toolchain go1.23.1
 
 require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/bmatcuk/doublestar/v4 v4.10.0
 	github.com/fbaube/fileutils v0.0.0-20250203130830-629d4e4bc31b
 	github.com/fbaube/mlog v0.0.0-20240425064535-3b89e3b28a76
+	golang.org/x/sys v0.29.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -23,6 +27,4 @@ require (
 	github.com/mgutz/str v1.2.0 // indirect
 	github.com/nbio/xml v0.0.0-20250127210239-7f9281fed8c6 // indirect
 	golang.org/x/exp v0.0.0-20250128182459-e0ece0dbea4c // indirect
-	golang.org/x/sys v0.29.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,163 @@
+package orderednodes
+
+// This file resolves relative links (like the href of a DITA topicref
+// or of an HTML <a>) between the Nords of a file tree, using the tree
+// rather than the disk, and makes such links. A link is relative to
+// the dir of the Nord that has it, uses "/" as its separator, and can
+// have a fragment (after "#"), which is about the contents of the file
+// and so is not used here.
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	S "strings"
+)
+
+// ErrUnresolved is returned (wrapped) when an href
+// does not lead to a Nord in the tree.
+var ErrUnresolved = errors.New("href does not resolve to a Nord")
+
+// IndexFileNames are the files that an href to a dir resolves to (the
+// first of them that the dir has), in order. If the dir has none of
+// them, the href resolves to the dir itself.
+var IndexFileNames = []string{"index.dita", "index.ditamap",
+	"index.md", "index.html", "_index.md"}
+
+// SplitHref splits an href into its path and its fragment
+// (without the "#"). A query (after "?") is dropped.
+func SplitHref(href string) (path, frag string) {
+	path, frag, _ = S.Cut(href, "#")
+	path, _, _ = S.Cut(path, "?")
+	return path, frag
+}
+
+// hrefBase is the dir that an href in p is relative to:
+// p itself if it is a dir, or else its parent.
+func hrefBase(p Norder) Norder {
+	if p.IsDir() || p.Parent() == nil {
+		return p
+	}
+	return p.Parent()
+}
+
+// Resolve returns the Nord that href (in the Nord from) leads to:
+//   - It is relative to from's dir (see above), unless it starts
+//     with "/", in which case it is relative to the root of the tree.
+//   - Its fragment is ignored (use [SplitHref] to get it), so an
+//     href that is just a fragment (or is "") leads to from itself.
+//   - Its path is percent-decoded, and "." and ".." work as usual,
+//     but ".." at the root is an error.
+//   - An href to a dir leads to its index file; see [IndexFileNames].
+//   - An href with a URL scheme (like "https:") is an error.
+//
+// If a name in the path has no Nord, the error wraps [ErrUnresolved].
+// .
+func Resolve(from Norder, href string) (Norder, error) {
+	if from == nil {
+		return nil, errors.New("Resolve: nil Norder")
+	}
+	path, _ := SplitHref(href)
+	if u, e := url.Parse(path); e != nil || u.Scheme != "" || u.Host != "" {
+		return nil, fmt.Errorf("Resolve <%s>: not a relative href: %s",
+			from.RelFP(), href)
+	}
+	path, e := url.PathUnescape(path)
+	if e != nil {
+		return nil, fmt.Errorf("Resolve <%s>: %s: %w", from.RelFP(), href, e)
+	}
+	if path == "" {
+		return from, nil
+	}
+	var n = hrefBase(from)
+	if S.HasPrefix(path, "/") {
+		root, e := RootOf(from)
+		if e != nil {
+			return nil, fmt.Errorf("Resolve: %w", e)
+		}
+		n = root
+	}
+	for _, name := range S.Split(path, "/") {
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if n.Parent() == nil {
+				return nil, fmt.Errorf("Resolve <%s>: %s: "+
+					"goes above the root: %w",
+					from.RelFP(), href, ErrUnresolved)
+			}
+			n = n.Parent()
+			continue
+		}
+		k := kidNamed(n, name)
+		if k == nil {
+			return nil, fmt.Errorf("Resolve <%s>: %s: no <%s> in <%s>: %w",
+				from.RelFP(), href, name, n.RelFP(), ErrUnresolved)
+		}
+		n = k
+	}
+	if n.IsDir() {
+		for _, fn := range IndexFileNames {
+			if k := kidNamed(n, fn); k != nil && !k.IsDir() {
+				return k, nil
+			}
+		}
+	}
+	return n, nil
+}
+
+// kidNamed returns p's kid called name, or nil.
+func kidNamed(p Norder, name string) Norder {
+	var g loopGuard
+	for k := p.FirstKid(); k != nil; k = k.NextKid() {
+		if g.loops(k) {
+			return nil
+		}
+		if kidName(k) == name {
+			return k
+		}
+	}
+	return nil
+}
+
+// RelativeHref returns the relative href from the Nord from to the
+// Nord to (in the same tree), which [Resolve] resolves back to to:
+// it goes up from from's dir with ".." as needed, and then down by
+// name, with each name percent-encoded (including any ":"). An
+// href to a dir ends in "/" (and so resolves to its index file, if
+// it has one). An href from a dir to itself is "./". To link to a
+// fragment, append "#" and the fragment. If the Nords are not in
+// the same tree, the error wraps [ErrNotSameTree].
+// .
+func RelativeHref(from, to Norder) (string, error) {
+	if from == nil || to == nil {
+		return "", errors.New("RelativeHref: nil Norder")
+	}
+	aa, bb, n, e := commonAncestry("RelativeHref", hrefBase(from), to)
+	if e != nil {
+		return "", e
+	}
+	var pp []string
+	for range aa[:len(aa)-n] {
+		pp = append(pp, "..")
+	}
+	for i := len(bb) - n - 1; i >= 0; i-- {
+		pp = append(pp, hrefEscape(kidName(bb[i])))
+	}
+	href := S.Join(pp, "/")
+	if to.IsDir() {
+		if href == "" {
+			return "./", nil
+		}
+		href += "/"
+	}
+	return href, nil
+}
+
+// hrefEscape percent-encodes a name for an href. Unlike
+// [url.PathEscape], it also encodes ":", so that a name like
+// "a:b.dita" at the start of an href is not taken for a URL scheme.
+func hrefEscape(name string) string {
+	return S.ReplaceAll(url.PathEscape(name), ":", "%3A")
+}
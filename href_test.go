@@ -0,0 +1,150 @@
+package orderednodes
+
+import (
+	"errors"
+	"testing"
+
+	FU "github.com/fbaube/fileutils"
+)
+
+// hrefTestTree returns a tree read from a temp dir that has these
+// files, and a func that finds a Nord in it by relPath ("" is the
+// root, and dirs have no trailing separator).
+func hrefTestTree(t *testing.T) (Norder, func(string) Norder) {
+	d := digestTestDir(t, map[string]string{
+		"maps/main.ditamap":         "",
+		"topics/intro.dita":         "",
+		"topics/sub/deep dive.dita": "",
+		"topics/sub/a:b.dita":       "",
+		"guide/index.dita":          "",
+		"guide/x.dita":              "",
+		"empty/y.md":                "",
+	})
+	root, e := NewDirTree(d, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	find := func(rel string) Norder {
+		if rel == "" {
+			return root
+		}
+		var found Norder
+		InspectTree(root, func(n Norder) error {
+			if !n.IsRoot() && FU.StripTrailingPathSep(n.RelFP()) == rel {
+				found = n
+				return SkipAll
+			}
+			return nil
+		})
+		if found == nil {
+			t.Fatalf("no <%s> in the tree", rel)
+		}
+		return found
+	}
+	return root, find
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		from, href string
+		// want is a relPath, or "!" for ErrUnresolved,
+		// or "?" for some other error.
+		want string
+	}{
+		{"maps/main.ditamap", "../topics/intro.dita", "topics/intro.dita"},
+		{"maps/main.ditamap", "../topics/intro.dita#intro/p1", "topics/intro.dita"},
+		{"maps/main.ditamap", "../topics/sub/deep%20dive.dita", "topics/sub/deep dive.dita"},
+		{"maps/main.ditamap", "../topics/sub/a%3Ab.dita", "topics/sub/a:b.dita"},
+		{"maps/main.ditamap", "../topics/./sub/../intro.dita?q=1", "topics/intro.dita"},
+		{"maps/main.ditamap", "/topics/intro.dita", "topics/intro.dita"},
+		{"maps/main.ditamap", "#frag", "maps/main.ditamap"},
+		{"maps/main.ditamap", "", "maps/main.ditamap"},
+		{"maps/main.ditamap", "../guide/", "guide/index.dita"},
+		{"maps/main.ditamap", "../guide", "guide/index.dita"},
+		{"maps/main.ditamap", "../empty/", "empty"},
+		{"maps", "main.ditamap", "maps/main.ditamap"},
+		{"", "topics/sub", "topics/sub"},
+		{"maps/main.ditamap", "../nope.dita", "!"},
+		{"maps/main.ditamap", "../topics/intro.dita/x", "!"},
+		{"maps/main.ditamap", "../../x", "!"},
+		{"maps/main.ditamap", "https://example.com/a.dita", "?"},
+		{"maps/main.ditamap", "%zz", "?"},
+	}
+	_, find := hrefTestTree(t)
+	for _, tc := range tests {
+		n, e := Resolve(find(tc.from), tc.href)
+		switch tc.want {
+		case "!":
+			if !errors.Is(e, ErrUnresolved) {
+				t.Errorf("%s in <%s>: got <%s> %v, want %v", tc.href,
+					tc.from, relFP(n), e, ErrUnresolved)
+			}
+		case "?":
+			if e == nil || errors.Is(e, ErrUnresolved) {
+				t.Errorf("%s in <%s>: got <%s> %v, want an error",
+					tc.href, tc.from, relFP(n), e)
+			}
+		default:
+			if e != nil || !sameNord(n, find(tc.want)) {
+				t.Errorf("%s in <%s>: got <%s> %v, want <%s>",
+					tc.href, tc.from, relFP(n), e, tc.want)
+			}
+		}
+	}
+}
+
+func TestRelativeHref(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     string
+	}{
+		{"maps/main.ditamap", "topics/intro.dita", "../topics/intro.dita"},
+		{"maps/main.ditamap", "topics/sub/deep dive.dita", "../topics/sub/deep%20dive.dita"},
+		{"topics/sub/deep dive.dita", "maps/main.ditamap", "../../maps/main.ditamap"},
+		{"topics/intro.dita", "topics/sub/a:b.dita", "sub/a%3Ab.dita"},
+		{"maps/main.ditamap", "maps/main.ditamap", "main.ditamap"},
+		{"maps/main.ditamap", "guide", "../guide/"},
+		{"maps", "maps", "./"},
+		{"", "", "./"},
+		{"", "topics/intro.dita", "topics/intro.dita"},
+		{"topics/sub", "topics", "../"},
+	}
+	root, find := hrefTestTree(t)
+	for _, tc := range tests {
+		got, e := RelativeHref(find(tc.from), find(tc.to))
+		if e != nil || got != tc.want {
+			t.Errorf("from <%s> to <%s>: got %q %v, want %q",
+				tc.from, tc.to, got, e, tc.want)
+		}
+	}
+	// Every href resolves back to its target
+	// (or to the index file of a dir).
+	var all []Norder
+	InspectTree(root, func(n Norder) error {
+		all = append(all, n)
+		return nil
+	})
+	for _, from := range all {
+		for _, to := range all {
+			h, e := RelativeHref(from, to)
+			if e != nil {
+				t.Fatal(e)
+			}
+			back, e := Resolve(from, h)
+			if e != nil {
+				t.Errorf("from <%s> to <%s>: %q: %v",
+					from.RelFP(), to.RelFP(), h, e)
+				continue
+			}
+			if !sameNord(back, to) && !(to.IsDir() &&
+				sameNord(back.Parent(), to) && kidName(back) == "index.dita") {
+				t.Errorf("from <%s> to <%s>: %q resolves to <%s>",
+					from.RelFP(), to.RelFP(), h, back.RelFP())
+			}
+		}
+	}
+	other, _ := hrefTestTree(t)
+	if _, e := RelativeHref(root, other); !errors.Is(e, ErrNotSameTree) {
+		t.Errorf("across trees: got %v", e)
+	}
+}
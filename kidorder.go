@@ -0,0 +1,215 @@
+package orderednodes
+
+// This file orders the kids of a Nord. A tree built by [NewDirTree]
+// has kids in lexical order by default, but docs often want another
+// order, such as "2-intro" before "10-advanced", or an order that is
+// listed in a file.
+
+import (
+	"bufio"
+	"cmp"
+	"os"
+	FP "path/filepath"
+	"slices"
+	S "strings"
+	"time"
+)
+
+// KidCmp compares two kids of the same Nord, as for [slices.SortFunc].
+type KidCmp func(a, b Norder) int
+
+// SortKids reorders p's kids (stably) using cmp, and relinks them.
+// Nothing else about the kids changes.
+func (p *Nord) SortKids(cmp KidCmp) {
+	kids := p.KidsAsSlice()
+	if len(kids) < 2 {
+		return
+	}
+	slices.SortStableFunc(kids, cmp)
+	var prev Norder
+	for _, k := range kids {
+		k.SetPrevKid(prev)
+		if prev != nil {
+			prev.SetNextKid(k)
+		}
+		prev = k
+	}
+	prev.SetNextKid(nil)
+	p.SetFirstKid(kids[0])
+	p.SetLastKid(prev)
+	if p.ids != nil {
+		p.setKidIdxs(kidIdxsOf(p))
+	}
+}
+
+// SortTree does [Nord.SortKids] for every Nord under (and including) p.
+func SortTree(p Norder, cmp KidCmp) error {
+	return InspectTree(p, func(n Norder) error {
+		n.nord().SortKids(cmp)
+		return nil
+	})
+}
+
+// kidName is the last element of a kid's relPath.
+func kidName(p Norder) string {
+	return NordDirEntry{p}.Name()
+}
+
+// LexicalOrder orders kids by name, like [os.ReadDir].
+func LexicalOrder(a, b Norder) int {
+	return S.Compare(kidName(a), kidName(b))
+}
+
+// NaturalOrder orders kids by name, but compares runs of digits
+// as numbers, so that "2-intro" comes before "10-advanced".
+func NaturalOrder(a, b Norder) int {
+	return NaturalCompare(kidName(a), kidName(b))
+}
+
+// NaturalCompare compares strings like [strings.Compare], except that
+// runs of digits are compared as numbers (of any length). If strings
+// differ only in leading zeroes, they are compared as strings.
+func NaturalCompare(a, b string) int {
+	var i, j int
+	for i < len(a) && j < len(b) {
+		ca, cb := a[i], b[j]
+		if !isDigit(ca) || !isDigit(cb) {
+			if ca != cb {
+				return cmp.Compare(ca, cb)
+			}
+			i++
+			j++
+			continue
+		}
+		// Compare the runs of digits, without leading zeroes.
+		i0, j0 := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		na := S.TrimLeft(a[i0:i], "0")
+		nb := S.TrimLeft(b[j0:j], "0")
+		if c := cmp.Compare(len(na), len(nb)); c != 0 {
+			return c
+		}
+		if c := S.Compare(na, nb); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(len(a)-i, len(b)-j); c != 0 {
+		return c
+	}
+	return S.Compare(a, b)
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// DirsFirst orders dirs (including symlinks to dirs) before
+// other kids, and otherwise uses then.
+func DirsFirst(then KidCmp) KidCmp {
+	return func(a, b Norder) int {
+		da, db := a.IsDirlike(), b.IsDirlike()
+		if da != db {
+			if da {
+				return -1
+			}
+			return 1
+		}
+		return then(a, b)
+	}
+}
+
+// ByModTime returns an order by modification time, oldest first,
+// and otherwise by then. A kid's time is from its file info (if it
+// has any; see [NordDirEntry]) or else from [os.Lstat], and is cached
+// by the returned KidCmp, so make a new one for each sort.
+func ByModTime(then KidCmp) KidCmp {
+	var times = make(map[*Nord]time.Time)
+	mtime := func(p Norder) time.Time {
+		if t, ok := times[p.nord()]; ok {
+			return t
+		}
+		var t time.Time
+		if fi := nordFileInfo(p); fi != nil {
+			t = fi.ModTime()
+		} else if fi, e := os.Lstat(p.AbsFP()); e == nil {
+			t = fi.ModTime()
+		}
+		times[p.nord()] = t
+		return t
+	}
+	return func(a, b Norder) int {
+		if c := mtime(a).Compare(mtime(b)); c != 0 {
+			return c
+		}
+		return then(a, b)
+	}
+}
+
+// OrderFileNames are the files that [ByOrderFile] looks for, in order.
+var OrderFileNames = []string{".order", "_index"}
+
+// ByOrderFile returns an order that is listed in a file in the kids'
+// dir: the first of [OrderFileNames] that exists. It lists names, one
+// per line (blank lines and lines that start with "#" are ignored),
+// and the kids that it lists come first, in that order, followed by
+// the other kids, ordered by then. The files are read only once by the
+// returned KidCmp, so make a new one for each sort.
+// .
+func ByOrderFile(then KidCmp) KidCmp {
+	var ranks = make(map[*Nord]map[string]int)
+	rank := func(p Norder) (int, bool) {
+		par := p.Parent()
+		if par == nil {
+			return 0, false
+		}
+		rr, ok := ranks[par.nord()]
+		if !ok {
+			rr = readOrderFile(par.AbsFP())
+			ranks[par.nord()] = rr
+		}
+		r, ok := rr[kidName(p)]
+		return r, ok
+	}
+	return func(a, b Norder) int {
+		ra, oka := rank(a)
+		rb, okb := rank(b)
+		switch {
+		case oka && okb:
+			return cmp.Compare(ra, rb)
+		case oka:
+			return -1
+		case okb:
+			return 1
+		}
+		return then(a, b)
+	}
+}
+
+// readOrderFile returns the rank of each name listed in
+// the order file in dir, or nil if there is none.
+func readOrderFile(dir string) map[string]int {
+	for _, fn := range OrderFileNames {
+		f, e := os.Open(FP.Join(dir, fn))
+		if e != nil {
+			continue
+		}
+		defer f.Close()
+		var rr = make(map[string]int)
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			name := S.TrimSpace(sc.Text())
+			if name == "" || S.HasPrefix(name, "#") {
+				continue
+			}
+			name = S.TrimSuffix(name, "/")
+			if _, dupe := rr[name]; !dupe {
+				rr[name] = len(rr)
+			}
+		}
+		return rr
+	}
+	return nil
+}
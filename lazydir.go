@@ -0,0 +1,199 @@
+package orderednodes
+
+// This file is a tree built from a directory whose dirs are not read
+// until their kids are needed, for trees that are too big to read up
+// front (like a whole disk), when only a few levels are looked at.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+
+	L "github.com/fbaube/mlog"
+)
+
+// LazyDirNord is a Nord for a dir, in a tree made by [NewLazyDirTree],
+// that reads its dir (and adds a kid for each item) the first time its
+// kids are needed, i.e. when any of FirstKid, LastKid, HasKids,
+// KidsAsSlice, KidCount, KidAt or AddKid is called. Its kids that are
+// dirs are LazyDirNords too, and are not read yet.
+//
+// Since the kids are read by methods that cannot return an error, an
+// error reading the dir is logged, and is available from [LazyDirNord.Err];
+// the dir then has the kids that were read OK (if any). Use
+// [LazyDirNord.Expand] to read dirs up front, and to get the errors.
+//
+// Note that anything that walks the whole tree (such as [InspectTree]
+// or [NewWatcher]) reads the whole tree. Reading a dir is guarded by
+// a lock, so concurrent readers (that do not otherwise modify the
+// tree) can share a tree of LazyDirNords.
+// .
+type LazyDirNord struct {
+	Nord
+	scan *dirScan
+	// mu guards expanded and err, and the
+	// reading of the dir that sets them.
+	mu       sync.Mutex
+	expanded bool
+	err      error
+}
+
+// NewLazyDirTree is like [NewDirTree], except that only the root is
+// made, and the kids of each dir are read when they are needed. The
+// options are as for NewDirTree, except that dirs are always made as
+// LazyDirNords (so NewNord is used only for other items), and MaxDepth
+// applies as for NewDirTree.
+// .
+func NewLazyDirTree(rootPath string, opts *DirTreeOptions) (*LazyDirNord, error) {
+	sc, e := newDirScan(opts)
+	if e != nil {
+		return nil, fmt.Errorf("NewLazyDirTree: %w", e)
+	}
+	sc.lazy = true
+	root, e := sc.newDirRoot(rootPath)
+	if e != nil {
+		return nil, fmt.Errorf("NewLazyDirTree: %w", e)
+	}
+	return root.(*LazyDirNord), nil
+}
+
+// newNord makes the Nord for an item: a LazyDirNord for
+// a dir in a lazy tree, or else as per the options.
+func (sc *dirScan) newNord(absPath string, d fs.DirEntry, isDir bool) (Norder, error) {
+	if sc.lazy && isDir {
+		return &LazyDirNord{scan: sc}, nil
+	}
+	return sc.opts.newNord(absPath, d)
+}
+
+// dirScanFor returns the dirScan to reconcile the tree of
+// root: a lazy tree's own, or else a new one for opts
+// (see [reconcileOptions]).
+func dirScanFor(root Norder, opts *DirTreeOptions) (*dirScan, error) {
+	if lz, ok := root.(*LazyDirNord); ok && lz.scan != nil {
+		return lz.scan, nil
+	}
+	opts, e := reconcileOptions(root, opts)
+	if e != nil {
+		return nil, e
+	}
+	return newDirScan(opts)
+}
+
+// dirIsRead is false for a LazyDirNord whose
+// dir has not been read yet, and true otherwise.
+func dirIsRead(p Norder) bool {
+	lz, ok := p.(*LazyDirNord)
+	return !ok || lz.Expanded()
+}
+
+// Expanded is true if the dir has been read (even if with an error).
+func (p *LazyDirNord) Expanded() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.expanded
+}
+
+// Err returns the error from reading the dir, or nil.
+func (p *LazyDirNord) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// load reads the dir, if it has not been read yet. The kids are
+// linked in by linkKid, not by p's own methods, which call load.
+func (p *LazyDirNord) load() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.expanded {
+		return
+	}
+	p.expanded = true
+	if e := p.scan.addDirKids(p); e != nil {
+		p.err = fmt.Errorf("LazyDirNord<%s>: %w", p.AbsFP(), e)
+		L.L.Error(p.err.Error())
+	}
+}
+
+// Expand reads the dirs under (and including) p to a depth of depth
+// levels (so, 1 reads only p's dir), or all of them if depth < 0.
+// A dir that was read with an error is read again (once), to retry.
+// It returns the errors from all of the dirs, joined.
+func (p *LazyDirNord) Expand(depth int) error {
+	if depth == 0 {
+		return nil
+	}
+	if p.Err() != nil {
+		// Retry it: drop the kids that were read OK.
+		for k := p.Nord.FirstKid(); k != nil; k = p.Nord.FirstKid() {
+			removeKid(p, k)
+		}
+		p.mu.Lock()
+		p.expanded, p.err = false, nil
+		p.mu.Unlock()
+	}
+	p.load()
+	var ee = []error{p.Err()}
+	if p.Level() >= MaxTreeDepth {
+		return errors.Join(append(ee, tooDeepError("Expand", p))...)
+	}
+	for k := p.Nord.FirstKid(); k != nil; k = k.NextKid() {
+		if lz, ok := k.(*LazyDirNord); ok {
+			ee = append(ee, lz.Expand(depth-1))
+		}
+	}
+	return errors.Join(ee...)
+}
+
+// FirstKid reads the dir if needed.
+func (p *LazyDirNord) FirstKid() Norder {
+	p.load()
+	return p.Nord.FirstKid()
+}
+
+// LastKid reads the dir if needed.
+func (p *LazyDirNord) LastKid() Norder {
+	p.load()
+	return p.Nord.LastKid()
+}
+
+// HasKids reads the dir if needed.
+func (p *LazyDirNord) HasKids() bool {
+	p.load()
+	return p.Nord.HasKids()
+}
+
+// KidsAsSlice reads the dir if needed.
+func (p *LazyDirNord) KidsAsSlice() []Norder {
+	p.load()
+	return p.Nord.KidsAsSlice()
+}
+
+// KidCount reads the dir if needed.
+func (p *LazyDirNord) KidCount() int {
+	p.load()
+	return p.Nord.KidCount()
+}
+
+// KidAt reads the dir if needed.
+func (p *LazyDirNord) KidAt(i int) Norder {
+	p.load()
+	return p.Nord.KidAt(i)
+}
+
+// AddKid reads the dir if needed (so that the kids from the dir
+// come first), and then is [Nord.AddKid], except that the kid's
+// parent link is to p, so that the kid's Parent is a LazyDirNord.
+func (p *LazyDirNord) AddKid(k Norder) Norder {
+	p.load()
+	return linkKid(p, k)
+}
+
+// AddKids is [Nord.AddKids], but using [LazyDirNord.AddKid].
+func (p *LazyDirNord) AddKids(kk []Norder) Norder {
+	p.load()
+	linkKids(p, kk)
+	return p
+}
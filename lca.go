@@ -0,0 +1,222 @@
+package orderednodes
+
+// This file answers questions about how two Nords in a tree are
+// related: their lowest common ancestor (LCA), and the path between
+// them through the tree. Each query walks up the parent links, so it
+// is O(depth). For a tree that is queried often, an [LCAIndex] answers
+// LCA queries in O(1), after O(n log n) preprocessing.
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+)
+
+// ErrNotSameTree is returned (wrapped) when two Nords
+// that must be in the same tree are not.
+var ErrNotSameTree = errors.New("Nords are not in the same tree")
+
+// ancestry returns p, its parent, its parent's parent, and so on,
+// up to a Nord that has no parent.
+func ancestry(op string, p Norder) ([]Norder, error) {
+	if p == nil {
+		return nil, fmt.Errorf("%s: nil Norder", op)
+	}
+	var g loopGuard
+	var aa = []Norder{p}
+	for n := p.Parent(); n != nil; n = n.Parent() {
+		if len(aa) > MaxTreeDepth {
+			return nil, tooDeepError(op, p)
+		}
+		if g.loops(n) {
+			return nil, fmt.Errorf("%s <%s>: parent links "+
+				"loop at <%s>: %w", op, p.RelFP(), n.RelFP(), ErrCycle)
+		}
+		aa = append(aa, n)
+	}
+	return aa, nil
+}
+
+// commonAncestry returns the ancestries of a and b, and the
+// number of Nords (from the top) that they have in common.
+func commonAncestry(op string, a, b Norder) (aa, bb []Norder, n int, e error) {
+	if aa, e = ancestry(op, a); e != nil {
+		return nil, nil, 0, e
+	}
+	if bb, e = ancestry(op, b); e != nil {
+		return nil, nil, 0, e
+	}
+	for n < len(aa) && n < len(bb) &&
+		sameNord(aa[len(aa)-1-n], bb[len(bb)-1-n]) {
+		n++
+	}
+	if n == 0 {
+		return nil, nil, 0, fmt.Errorf("%s: <%s> and <%s>: %w",
+			op, a.RelFP(), b.RelFP(), ErrNotSameTree)
+	}
+	return aa, bb, n, nil
+}
+
+// IsAncestorOf is true if a is b's parent, or its parent's
+// parent, and so on. A Nord is not its own ancestor.
+func IsAncestorOf(a, b Norder) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	var g loopGuard
+	for n, i := b.Parent(), 0; n != nil && i <= MaxTreeDepth; n, i = n.Parent(), i+1 {
+		if sameNord(n, a) {
+			return true
+		}
+		if g.loops(n) {
+			return false
+		}
+	}
+	return false
+}
+
+// LCA returns the lowest common ancestor of a and b: the deepest
+// Nord that is an ancestor of both or is one of them (so, the LCA of
+// a Nord and its descendant is the Nord itself). If a and b are not
+// in the same tree, the error wraps [ErrNotSameTree].
+func LCA(a, b Norder) (Norder, error) {
+	aa, _, n, e := commonAncestry("LCA", a, b)
+	if e != nil {
+		return nil, e
+	}
+	return aa[len(aa)-n], nil
+}
+
+// Distance returns the number of links between a and b through
+// the tree, i.e. their depths below their LCA, added together.
+func Distance(a, b Norder) (int, error) {
+	aa, bb, n, e := commonAncestry("Distance", a, b)
+	if e != nil {
+		return 0, e
+	}
+	return len(aa) - n + len(bb) - n, nil
+}
+
+// PathBetween returns the Nords on the path through the tree from a
+// to b, including both: up from a to their LCA, and then down to b.
+// So its length is [Distance] plus 1, and if a and b are the same
+// Nord, it is just that Nord.
+func PathBetween(a, b Norder) ([]Norder, error) {
+	aa, bb, n, e := commonAncestry("PathBetween", a, b)
+	if e != nil {
+		return nil, e
+	}
+	// Up to and including the LCA, then down from below it.
+	var pp = slices.Clone(aa[:len(aa)-n+1])
+	down := slices.Clone(bb[:len(bb)-n])
+	slices.Reverse(down)
+	return append(pp, down...), nil
+}
+
+// LCAIndex answers LCA queries for a tree in O(1) time, using an
+// Euler tour of the tree and a sparse table of minimum depths over
+// it. It takes O(n log n) time and space to make, for n Nords. It
+// is a snapshot: if the tree is changed, make a new one. It is safe
+// for concurrent use.
+type LCAIndex struct {
+	// tour is the Euler tour: each Nord, followed by each
+	// kid's subtree's tour with the Nord again after it.
+	tour  []Norder
+	depth []int
+	// first is the index in tour of each Nord's first visit.
+	first map[*Nord]int
+	// sparse[k][i] is the index in tour of the shallowest
+	// Nord in tour[i : i+2^k].
+	sparse [][]int
+}
+
+// NewLCAIndex makes an LCAIndex for the tree under (and including) p.
+func NewLCAIndex(p Norder) (*LCAIndex, error) {
+	var x = &LCAIndex{first: make(map[*Nord]int)}
+	// open is the path from p to the Nord being visited.
+	var open []Norder
+	e := inspectTreeIteratively(p,
+		func(n Norder) error {
+			x.first[n.nord()] = len(x.tour)
+			x.tour = append(x.tour, n)
+			x.depth = append(x.depth, len(open))
+			open = append(open, n)
+			return nil
+		},
+		func(n Norder) error {
+			open = open[:len(open)-1]
+			if len(open) > 0 {
+				x.tour = append(x.tour, open[len(open)-1])
+				x.depth = append(x.depth, len(open)-1)
+			}
+			return nil
+		}, "NewLCAIndex")
+	if e != nil {
+		return nil, e
+	}
+	var row = make([]int, len(x.tour))
+	for i := range row {
+		row[i] = i
+	}
+	x.sparse = append(x.sparse, row)
+	for w := 1; 2*w <= len(x.tour); w *= 2 {
+		prev := x.sparse[len(x.sparse)-1]
+		row := make([]int, len(x.tour)-2*w+1)
+		for i := range row {
+			row[i] = x.shallower(prev[i], prev[i+w])
+		}
+		x.sparse = append(x.sparse, row)
+	}
+	return x, nil
+}
+
+// shallower returns whichever of the tour indices i and j has the
+// lesser depth.
+func (x *LCAIndex) shallower(i, j int) int {
+	if x.depth[j] < x.depth[i] {
+		return j
+	}
+	return i
+}
+
+// LCA is like [LCA], but in O(1) time. If a or b is not in the
+// indexed tree, the error wraps [ErrNotSameTree].
+func (x *LCAIndex) LCA(a, b Norder) (Norder, error) {
+	i, j, e := x.span("LCAIndex.LCA", a, b)
+	if e != nil {
+		return nil, e
+	}
+	return x.tour[x.shallowestIn(i, j)], nil
+}
+
+// Distance is like [Distance], but in O(1) time.
+func (x *LCAIndex) Distance(a, b Norder) (int, error) {
+	i, j, e := x.span("LCAIndex.Distance", a, b)
+	if e != nil {
+		return 0, e
+	}
+	return x.depth[i] + x.depth[j] - 2*x.depth[x.shallowestIn(i, j)], nil
+}
+
+// span returns the first tour indices of a and b, in order.
+func (x *LCAIndex) span(op string, a, b Norder) (int, int, error) {
+	for _, n := range []Norder{a, b} {
+		if n == nil {
+			return 0, 0, fmt.Errorf("%s: nil Norder", op)
+		}
+		if _, ok := x.first[n.nord()]; !ok {
+			return 0, 0, fmt.Errorf("%s: <%s>: %w",
+				op, n.RelFP(), ErrNotSameTree)
+		}
+	}
+	i, j := x.first[a.nord()], x.first[b.nord()]
+	return min(i, j), max(i, j), nil
+}
+
+// shallowestIn returns the tour index of the shallowest Nord in
+// tour[i : j+1], by combining two (overlapping) spans of the table.
+func (x *LCAIndex) shallowestIn(i, j int) int {
+	k := bits.Len(uint(j-i+1)) - 1
+	return x.shallower(x.sparse[k][i], x.sparse[k][j-(1<<k)+1])
+}
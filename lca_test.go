@@ -0,0 +1,112 @@
+package orderednodes
+
+import (
+	"errors"
+	S "strings"
+	"testing"
+)
+
+// lcaTestTree returns this tree, and its Nords by relPath:
+//
+//	.
+//	├── a
+//	│   ├── a/x
+//	│   │   └── a/x/p
+//	│   └── a/y
+//	└── b
+//	    └── b/z
+func lcaTestTree() (*Nord, map[string]Norder) {
+	r := &Nord{relPath: ".", absPath: "/r/", isRoot: true, isDir: true}
+	var byPath = map[string]Norder{".": r}
+	add := func(par, rel string) {
+		k := &Nord{relPath: rel}
+		byPath[par].AddKid(k)
+		byPath[rel] = k
+	}
+	add(".", "a")
+	add("a", "a/x")
+	add("a/x", "a/x/p")
+	add("a", "a/y")
+	add(".", "b")
+	add("b", "b/z")
+	return r, byPath
+}
+
+func TestLCA(t *testing.T) {
+	tests := []struct {
+		a, b string
+		lca  string
+		path string
+	}{
+		{".", ".", ".", "."},
+		{"a/x/p", "a/x/p", "a/x/p", "a/x/p"},
+		{"a", "a/x/p", "a", "a a/x a/x/p"},
+		{"a/x/p", "a", "a", "a/x/p a/x a"},
+		{"a/x", "a/y", "a", "a/x a a/y"},
+		{"a/x/p", "a/y", "a", "a/x/p a/x a a/y"},
+		{"a/x/p", "b/z", ".", "a/x/p a/x a . b b/z"},
+		{"b/z", ".", ".", "b/z b ."},
+	}
+	root, byPath := lcaTestTree()
+	x, e := NewLCAIndex(root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, tc := range tests {
+		a, b := byPath[tc.a], byPath[tc.b]
+		l, e := LCA(a, b)
+		if e != nil || l.RelFP() != tc.lca {
+			t.Errorf("LCA(%s, %s): got <%s> %v, want <%s>",
+				tc.a, tc.b, relFP(l), e, tc.lca)
+		}
+		l, e = x.LCA(a, b)
+		if e != nil || l.RelFP() != tc.lca {
+			t.Errorf("LCAIndex.LCA(%s, %s): got <%s> %v, want <%s>",
+				tc.a, tc.b, relFP(l), e, tc.lca)
+		}
+		pp, e := PathBetween(a, b)
+		var ss []string
+		for _, p := range pp {
+			ss = append(ss, p.RelFP())
+		}
+		if e != nil || S.Join(ss, " ") != tc.path {
+			t.Errorf("PathBetween(%s, %s): got %v %v, want %s",
+				tc.a, tc.b, ss, e, tc.path)
+		}
+		wantDist := len(S.Fields(tc.path)) - 1
+		if d, e := Distance(a, b); e != nil || d != wantDist {
+			t.Errorf("Distance(%s, %s): got %d %v, want %d",
+				tc.a, tc.b, d, e, wantDist)
+		}
+		if d, e := x.Distance(a, b); e != nil || d != wantDist {
+			t.Errorf("LCAIndex.Distance(%s, %s): got %d %v, want %d",
+				tc.a, tc.b, d, e, wantDist)
+		}
+		wantAnc := tc.lca == tc.a && tc.a != tc.b
+		if got := IsAncestorOf(a, b); got != wantAnc {
+			t.Errorf("IsAncestorOf(%s, %s): got %v", tc.a, tc.b, got)
+		}
+	}
+}
+
+func TestLCANotSameTree(t *testing.T) {
+	root, byPath := lcaTestTree()
+	other, _ := lcaTestTree()
+	x, e := NewLCAIndex(root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	a, b := byPath["a/y"], other.FirstKid()
+	if _, e := LCA(a, b); !errors.Is(e, ErrNotSameTree) {
+		t.Errorf("LCA: got %v", e)
+	}
+	if _, e := PathBetween(a, b); !errors.Is(e, ErrNotSameTree) {
+		t.Errorf("PathBetween: got %v", e)
+	}
+	if _, e := x.LCA(a, b); !errors.Is(e, ErrNotSameTree) {
+		t.Errorf("LCAIndex.LCA: got %v", e)
+	}
+	if IsAncestorOf(root, b) {
+		t.Error("IsAncestorOf across trees")
+	}
+}
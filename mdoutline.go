@@ -0,0 +1,335 @@
+package orderednodes
+
+// This file turns the heading structure of a Markdown document
+// (CommonMark, or LwDITA MDITA, which is CommonMark plus a YAML
+// header) into a tree of sections, i.e. a ToC for a single topic.
+
+import (
+	"fmt"
+	"io"
+	FP "path/filepath"
+	S "strings"
+	"unicode"
+
+	FU "github.com/fbaube/fileutils"
+)
+
+// MdSection is a Nord for a section of a Markdown document: a heading
+// plus everything up to the next heading of the same or higher rank.
+// The root MdSection is the whole document, and its own body is any
+// text that precedes the first heading.
+//
+// The Nord level of a section is its depth in the tree, which is not
+// always its HeadingLevel, because heading levels can be skipped (as
+// in "#" followed by "###"). A heading becomes a kid of the nearest
+// preceding heading that has a smaller HeadingLevel.
+//
+// The relPath of a section is a materialized path of anchor IDs
+// (see [MdAnchor]), and its absPath is the document's absolute
+// path plus "#" plus its anchor ID.
+//
+// All offsets are byte offsets into the document.
+// .
+type MdSection struct {
+	Nord
+	// Title is the heading text, without the "#"s or underline.
+	Title string
+	// Anchor is the section's ID for linking, as per [MdAnchor],
+	// made unique within the document (as GitHub does) by appending
+	// "-1", "-2", etc., skipping any that is already an anchor.
+	Anchor string
+	// HeadingLevel is 1..6, or 0 for the root.
+	HeadingLevel int
+	// Start is where the heading starts.
+	Start int
+	// BodyStart is just after the heading's last line.
+	BodyStart int
+	// BodyEnd is where the first subsection (or the next
+	// section) starts, so [BodyStart,BodyEnd) is the
+	// section's own text.
+	BodyEnd int
+	// End is where the next section of the same or higher
+	// rank starts, so [Start,End) includes all subsections.
+	End int
+}
+
+// AddKid is [Nord.AddKid], except that the kid's parent
+// link is to p, so that its Parent is a *MdSection.
+func (p *MdSection) AddKid(k Norder) Norder {
+	return linkKid(p, k)
+}
+
+// AddKids is [Nord.AddKids], but using [MdSection.AddKid].
+func (p *MdSection) AddKids(kk []Norder) Norder {
+	linkKids(p, kk)
+	return p
+}
+
+// LineSummaryString shows the heading.
+func (p *MdSection) LineSummaryString() string {
+	if p.IsRoot() {
+		return "ROOT " + p.relPath
+	}
+	return S.Repeat("#", p.HeadingLevel) + " " + p.Title
+}
+
+// ReadMarkdownOutline reads a whole Markdown document from r
+// and returns [ParseMarkdownOutline] of it.
+func ReadMarkdownOutline(r io.Reader, docPath string) (*MdSection, error) {
+	bb, e := io.ReadAll(r)
+	if e != nil {
+		return nil, fmt.Errorf("ReadMarkdownOutline: %w", e)
+	}
+	return ParseMarkdownOutline(bb, docPath), nil
+}
+
+// ParseMarkdownOutline returns the tree of sections of the Markdown
+// document src, whose path is docPath. It recognizes ATX headings
+// ("# Title") and setext headings (a line of text underlined with
+// "===" or "---"), but not in a YAML header, and not in fenced or
+// indented code blocks.
+// .
+func ParseMarkdownOutline(src []byte, docPath string) *MdSection {
+	root := new(MdSection)
+	root.relPath = docPath
+	root.absPath = FU.AbsFP(FP.Clean(docPath))
+	root.isRoot = true
+	root.lineSummaryFunc = NordEng.summaryString
+	root.BodyEnd = -1
+
+	// anchors are the anchor IDs so far, and dupes is how
+	// many times each [MdAnchor] has been seen already.
+	var anchors = make(map[string]bool)
+	var dupes = make(map[string]int)
+	// stack holds the open sections, root first.
+	var stack = []*MdSection{root}
+	addHeading := func(level, start, bodyStart int, title string) {
+		for len(stack) > 1 && stack[len(stack)-1].HeadingLevel >= level {
+			stack[len(stack)-1].close(start)
+			stack = stack[:len(stack)-1]
+		}
+		par := stack[len(stack)-1]
+		if par.BodyEnd < 0 {
+			par.BodyEnd = start
+		}
+		p := new(MdSection)
+		p.Title = title
+		base := MdAnchor(title)
+		p.Anchor = base
+		for anchors[p.Anchor] {
+			dupes[base]++
+			p.Anchor = fmt.Sprintf("%s-%d", base, dupes[base])
+		}
+		anchors[p.Anchor] = true
+		p.HeadingLevel = level
+		p.Start = start
+		p.BodyStart = bodyStart
+		p.BodyEnd = -1
+		label := p.Anchor
+		if label == "" {
+			label = "_"
+		}
+		p.relPath = kidRelPath(par, label)
+		p.absPath = FU.AbsFilePath(root.absPath.S() + "#" + p.Anchor)
+		p.lineSummaryFunc = NordEng.summaryString
+		par.AddKid(p)
+		stack = append(stack, p)
+	}
+
+	var s = string(src)
+	var pos = mdSkipYamlHeader(s)
+	// fence is the open code fence ("```" or "~~~", maybe longer).
+	var fence string
+	// paraStart is where the current paragraph started, or -1.
+	var paraStart = -1
+	for pos < len(s) {
+		lineEnd := S.IndexByte(s[pos:], '\n')
+		next := len(s)
+		if lineEnd < 0 {
+			lineEnd = len(s)
+		} else {
+			lineEnd += pos
+			next = lineEnd + 1
+		}
+		line := S.TrimRight(s[pos:lineEnd], "\r")
+		indent, rest := mdIndent(line)
+
+		if fence != "" {
+			if indent < 4 && S.HasPrefix(rest, fence) &&
+				S.Trim(rest, fence[:1]+" \t") == "" {
+				fence = ""
+			}
+		} else if S.TrimSpace(line) == "" {
+			paraStart = -1
+		} else if indent >= 4 && paraStart < 0 {
+			// indented code
+		} else if f := mdFence(rest); indent < 4 && f != "" {
+			fence = f
+			paraStart = -1
+		} else if lvl, title, ok := mdATX(rest); indent < 4 && ok {
+			addHeading(lvl, pos, next, title)
+			paraStart = -1
+		} else if lvl := mdSetext(rest); indent < 4 && lvl > 0 && paraStart >= 0 {
+			title := S.Join(S.Fields(s[paraStart:pos]), " ")
+			addHeading(lvl, paraStart, next, title)
+			paraStart = -1
+		} else if indent < 4 && (mdIsBreak(rest) || mdIsBlockStart(rest)) {
+			// A list item or quote is not a paragraph
+			// that a setext underline can make a heading.
+			paraStart = -1
+		} else if paraStart < 0 {
+			paraStart = pos
+		}
+		pos = next
+	}
+	for _, p := range stack {
+		p.close(len(s))
+	}
+	return root
+}
+
+// close sets End (and BodyEnd, if there were no subsections).
+func (p *MdSection) close(end int) {
+	p.End = end
+	if p.BodyEnd < 0 {
+		p.BodyEnd = end
+	}
+}
+
+// MdAnchor returns the anchor ID for a heading, as made by GitHub and
+// many other renderers: lower-cased, with spaces turned into hyphens,
+// and with punctuation other than hyphens and underscores removed.
+func MdAnchor(title string) string {
+	var sb S.Builder
+	for _, r := range S.ToLower(S.TrimSpace(title)) {
+		switch {
+		case r == ' ':
+			sb.WriteRune('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) ||
+			unicode.IsDigit(r) || unicode.IsMark(r):
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// mdSkipYamlHeader returns where the text starts after any YAML
+// header, which is delimited by "---" lines (or "---" and "...").
+func mdSkipYamlHeader(s string) int {
+	if !S.HasPrefix(s, "---\n") && !S.HasPrefix(s, "---\r\n") {
+		return 0
+	}
+	pos := S.IndexByte(s, '\n') + 1
+	for pos < len(s) {
+		end := S.IndexByte(s[pos:], '\n')
+		if end < 0 {
+			end = len(s) - pos
+		}
+		line := S.TrimRight(s[pos:pos+end], "\r \t")
+		pos += end + 1
+		if line == "---" || line == "..." {
+			return min(pos, len(s))
+		}
+	}
+	// Not terminated, so it was not a header after all.
+	return 0
+}
+
+// mdIndent returns the width of a line's leading whitespace
+// (with a tab counting as 4) and the rest of the line.
+func mdIndent(line string) (int, string) {
+	var n int
+	for i, r := range line {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 4 - n%4
+		default:
+			return n, line[i:]
+		}
+	}
+	return n, ""
+}
+
+// mdFence returns the fence that opens a fenced code block, or "".
+func mdFence(rest string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(rest) - len(S.TrimLeft(rest, c))
+		if n >= 3 {
+			// A backtick fence's info string cannot contain a backtick.
+			if c == "`" && S.Contains(rest[n:], "`") {
+				return ""
+			}
+			return rest[:n]
+		}
+	}
+	return ""
+}
+
+// mdATX parses an ATX heading, like "## Title ##".
+func mdATX(rest string) (level int, title string, ok bool) {
+	level = len(rest) - len(S.TrimLeft(rest, "#"))
+	if level < 1 || level > 6 {
+		return 0, "", false
+	}
+	rest = rest[level:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return 0, "", false
+	}
+	title = S.TrimSpace(rest)
+	// Remove an optional closing sequence of "#"s.
+	if t := S.TrimRight(title, "#"); t != title {
+		if t == "" {
+			title = ""
+		} else if S.HasSuffix(t, " ") || S.HasSuffix(t, "\t") {
+			title = S.TrimSpace(t)
+		}
+	}
+	return level, title, true
+}
+
+// mdSetext returns 1 for a "===" underline, 2 for a "---"
+// underline, or 0 if rest is not a setext underline.
+func mdSetext(rest string) int {
+	t := S.TrimRight(rest, " \t")
+	if t == "" {
+		return 0
+	}
+	switch {
+	case S.Trim(t, "=") == "":
+		return 1
+	case S.Trim(t, "-") == "":
+		return 2
+	}
+	return 0
+}
+
+// mdIsBreak is true for a thematic break, like "***" or "- - -".
+func mdIsBreak(rest string) bool {
+	t := S.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, rest)
+	if len(t) < 3 {
+		return false
+	}
+	return S.Trim(t, t[:1]) == "" && S.ContainsAny(t[:1], "-*_")
+}
+
+// mdIsBlockStart is true for the start of a list item or a quote.
+func mdIsBlockStart(rest string) bool {
+	if S.HasPrefix(rest, ">") {
+		return true
+	}
+	if len(rest) >= 2 && S.ContainsAny(rest[:1], "-*+") &&
+		(rest[1] == ' ' || rest[1] == '\t') {
+		return true
+	}
+	digits := len(rest) - len(S.TrimLeft(rest, "0123456789"))
+	return digits > 0 && digits <= 9 && len(rest) > digits+1 &&
+		S.ContainsAny(rest[digits:digits+1], ".)") &&
+		(rest[digits+1] == ' ' || rest[digits+1] == '\t')
+}
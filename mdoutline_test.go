@@ -0,0 +1,117 @@
+package orderednodes
+
+import (
+	"bytes"
+	"fmt"
+	S "strings"
+	"testing"
+)
+
+// mdDump returns a line for each section under (and including)
+// root, in preorder, like "  ## Title #anchor".
+func mdDump(root *MdSection) []string {
+	var ss []string
+	InspectTree(root, func(n Norder) error {
+		p := n.(*MdSection)
+		if !p.IsRoot() {
+			ss = append(ss, fmt.Sprintf("%s%s #%s",
+				S.Repeat("  ", p.Level()-1), p.LineSummaryString(), p.Anchor))
+		}
+		return nil
+	})
+	return ss
+}
+
+func TestMarkdownOutline(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"no headings", "Just text.\n", nil},
+		{"ATX", "# A\ntext\n## B\n### C\n## D ##\n# E\n", []string{
+			"# A #a", "  ## B #b", "    ### C #c", "  ## D #d", "# E #e"}},
+		{"skipped levels", "### Deep\n# Top\n### Skip\n## Mid\n", []string{
+			"### Deep #deep", "# Top #top", "  ### Skip #skip", "  ## Mid #mid"}},
+		{"setext", "Big\n===\n\nSmall\n---\n", []string{
+			"# Big #big", "  ## Small #small"}},
+		{"multi-line setext", "Two\nlines\n===\n", []string{
+			"# Two lines #two-lines"}},
+		{"not headings", "#NoSpace\n\n- item\n---\n\n    # indented\n" +
+			"```\n# fenced\n```\n~~~~\n```\n# still fenced\n~~~~\n", nil},
+		{"YAML header", "---\ntitle: x\n# comment\n---\n# A\n", []string{
+			"# A #a"}},
+		{"duplicate anchors", "# A\n# A\n# A\n", []string{
+			"# A #a", "# A #a-1", "# A #a-2"}},
+		{"duplicate of a suffixed anchor", "# A-1\n# A\n# A\n# A 1\n", []string{
+			"# A-1 #a-1", "# A #a", "# A #a-2", "# A 1 #a-1-1"}},
+		{"punctuation", "# What's *new*? (v2.0)\n", []string{
+			"# What's *new*? (v2.0) #whats-new-v20"}},
+		{"empty heading", "#\n", []string{"#  #"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := ParseMarkdownOutline([]byte(tc.src), "/d/t.md")
+			got := mdDump(root)
+			if S.Join(got, "\n") != S.Join(tc.want, "\n") {
+				t.Errorf("got:\n%s\nwant:\n%s",
+					S.Join(got, "\n"), S.Join(tc.want, "\n"))
+			}
+			checkMdRanges(t, root, tc.src)
+		})
+	}
+}
+
+// checkMdRanges checks that the sections' own text, in preorder,
+// is the whole document, and that each section's range holds
+// those of its kids.
+func checkMdRanges(t *testing.T, root *MdSection, src string) {
+	t.Helper()
+	var sb S.Builder
+	InspectTree(root, func(n Norder) error {
+		p := n.(*MdSection)
+		if p.Start > p.BodyStart || p.BodyStart > p.BodyEnd ||
+			p.BodyEnd > p.End {
+			t.Errorf("<%s>: bad offsets %d %d %d %d", p.RelFP(),
+				p.Start, p.BodyStart, p.BodyEnd, p.End)
+			return nil
+		}
+		sb.WriteString(src[p.Start:p.BodyEnd])
+		for k := p.FirstKid(); k != nil; k = k.NextKid() {
+			kp := k.(*MdSection)
+			if kp.Start < p.BodyEnd || kp.End > p.End {
+				t.Errorf("<%s> is not inside <%s>", kp.RelFP(), p.RelFP())
+			}
+		}
+		return nil
+	})
+	if sb.String() != src {
+		t.Errorf("sections are:\n%q\nnot:\n%q", sb.String(), src)
+	}
+}
+
+func TestReadMarkdownOutline(t *testing.T) {
+	src := "Preamble\n\n# One\nbody\n## Two\nmore\n"
+	root, e := ReadMarkdownOutline(bytes.NewReader([]byte(src)), "/d/t.md")
+	if e != nil {
+		t.Fatal(e)
+	}
+	one := root.FirstKid().(*MdSection)
+	two := one.FirstKid().(*MdSection)
+	if got := src[root.BodyStart:root.BodyEnd]; got != "Preamble\n\n" {
+		t.Errorf("root body: got %q", got)
+	}
+	if got := src[one.BodyStart:one.BodyEnd]; got != "body\n" {
+		t.Errorf("section body: got %q", got)
+	}
+	if two.Parent().(*MdSection) != one {
+		t.Error("kid's parent is not the *MdSection")
+	}
+	if got := two.AbsFP(); got != "/d/t.md#two" {
+		t.Errorf("AbsFP: got %q", got)
+	}
+	if got := two.RelFP(); got != "one/two" {
+		t.Errorf("RelFP: got %q", got)
+	}
+}
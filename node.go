@@ -0,0 +1,163 @@
+package orderednodes
+
+// This file is a generic API on top of Nord: a [Node] carries a typed
+// payload, and its navigation methods return *Node[T] rather than
+// Norder, so no type assertions are needed. A *Node[T] is a Norder,
+// so everything else in this package works on it too.
+//
+// It also has generic iterators (like [All]) that work on any tree,
+// such as one of structs that embed Nord.
+
+import (
+	"iter"
+	FP "path/filepath"
+
+	FU "github.com/fbaube/fileutils"
+)
+
+// Node is a Nord with a payload of type T.
+//
+// The typed navigation methods (like [Node.ParentNode]) return nil
+// for a Nord that is not a *Node[T], which can happen only if a tree
+// mixes Nodes with other Norders.
+// .
+type Node[T any] struct {
+	Nord
+	Value T
+}
+
+// NewRootNode returns a root whose relPath is path, and whose
+// absPath is the absolute path of path (as for [NewRootTocNord]).
+func NewRootNode[T any](path string, v T) *Node[T] {
+	n := &Node[T]{Value: v}
+	n.relPath = path
+	n.absPath = FU.AbsFP(FP.Clean(path))
+	n.isRoot = true
+	n.lineSummaryFunc = NordEng.summaryString
+	return n
+}
+
+// NewKidNode returns a Node with its paths set as if it were a kid
+// of par called label (like a file in a dir), but not yet added.
+func NewKidNode[T any](par Norder, label string, v T) *Node[T] {
+	n := &Node[T]{Value: v}
+	n.relPath = kidRelPath(par, label)
+	n.absPath = FU.AbsFilePath(FP.Join(par.AbsFP(), label))
+	n.lineSummaryFunc = NordEng.summaryString
+	return n
+}
+
+// Add makes a kid called label with the payload v,
+// and adds it as the last kid.
+func (n *Node[T]) Add(label string, v T) *Node[T] {
+	k := NewKidNode(n, label, v)
+	n.AddKid(k)
+	return k
+}
+
+// AddKid is [Nord.AddKid], except that the kid's parent
+// link is to n, so that [Node.ParentNode] can find it.
+func (n *Node[T]) AddKid(k Norder) Norder {
+	return linkKid(n, k)
+}
+
+// AddKids is [Nord.AddKids], but using [Node.AddKid].
+func (n *Node[T]) AddKids(kk []Norder) Norder {
+	linkKids(n, kk)
+	return n
+}
+
+// NodeOf returns p as a *Node[T], or nil if it is not one.
+func NodeOf[T any](p Norder) *Node[T] {
+	n, _ := p.(*Node[T])
+	return n
+}
+
+// ParentNode returns the parent, or nil.
+func (n *Node[T]) ParentNode() *Node[T] {
+	return nodeOrNil[T](n.parent)
+}
+
+// FirstKidNode returns the first kid, or nil.
+func (n *Node[T]) FirstKidNode() *Node[T] {
+	return nodeOrNil[T](n.firstKid)
+}
+
+// LastKidNode returns the last kid, or nil.
+func (n *Node[T]) LastKidNode() *Node[T] {
+	return nodeOrNil[T](n.lastKid)
+}
+
+// PrevKidNode returns the previous sibling, or nil.
+func (n *Node[T]) PrevKidNode() *Node[T] {
+	return nodeOrNil[T](n.prevKid)
+}
+
+// NextKidNode returns the next sibling, or nil.
+func (n *Node[T]) NextKidNode() *Node[T] {
+	return nodeOrNil[T](n.nextKid)
+}
+
+// KidNodeAt returns the kid at index i (see [Nord.KidAt]), or nil.
+func (n *Node[T]) KidNodeAt(i int) *Node[T] {
+	return nodeOrNil[T](n.KidAt(i))
+}
+
+// RootNode returns the root, or nil if the tree is
+// damaged (see [RootOf]) or the root is not a *Node[T].
+func (n *Node[T]) RootNode() *Node[T] {
+	r, e := RootOf(n)
+	if e != nil {
+		return nil
+	}
+	return nodeOrNil[T](r)
+}
+
+// KidNodes iterates over the kids, in order.
+func (n *Node[T]) KidNodes() iter.Seq[*Node[T]] {
+	return Kids[*Node[T]](n)
+}
+
+// AllNodes iterates over the tree under (and including) n, in preorder.
+func (n *Node[T]) AllNodes() iter.Seq[*Node[T]] {
+	return All[*Node[T]](n)
+}
+
+func nodeOrNil[T any](p Norder) *Node[T] {
+	if p == nil {
+		return nil
+	}
+	return NodeOf[T](p)
+}
+
+// Kids iterates over the kids of p that are of type N (such as
+// *Node[T], or a struct that embeds Nord), skipping any others.
+// If the kid list loops, it stops at the loop.
+func Kids[N Norder](p Norder) iter.Seq[N] {
+	return func(yield func(N) bool) {
+		var g loopGuard
+		for k := p.FirstKid(); k != nil; k = k.NextKid() {
+			if g.loops(k) {
+				return
+			}
+			if n, ok := k.(N); ok && !yield(n) {
+				return
+			}
+		}
+	}
+}
+
+// All iterates in preorder over the Norders of type N (such as
+// *Node[T], or a struct that embeds Nord) in the tree under (and
+// including) p, skipping any others (but not their kids). It does
+// not recurse, and it stops at any loop in the links.
+func All[N Norder](p Norder) iter.Seq[N] {
+	return func(yield func(N) bool) {
+		inspectTreeIterativelyUntil(p, func(k Norder) error {
+			if n, ok := k.(N); ok && !yield(n) {
+				return SkipAll
+			}
+			return nil
+		}, nil, "All")
+	}
+}
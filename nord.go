@@ -90,9 +90,9 @@ type StringFunc func(Norder) string
 //
 // NOTE: This implementation stores pointers to child nodes in a doubly
 // linked list, not a slice, and a Nord does not have a complete set of
-// pointers to all of its kids. Therefore (a) it is not simple to get a
-// kid count, because it requires a list traversal, and (b) it is not
-// feasible to use this same code to define a simpler, more efficient 
+// pointers to all of its kids. Therefore (a) a kid count requires a
+// list traversal (but it is cached: see [Nord.KidCount]), and (b) it
+// is not feasible to use this same code to define a simpler, more efficient 
 // variant of Nord that has unordered kids. 
 // .
 type Nord struct {
@@ -118,8 +118,15 @@ type Nord struct {
 	// environment (for a file or dir, the file system root; for
 	// a markup node, the absolute path of the containing file. 
 	isRoot bool
-	// isDir is obvious for files & dirs BUT not (yet) for symlinks. 
+	// isDir is obvious for files & dirs. For a symlink, it is
+	// true only if the link was followed (see [SymlinkFollow]),
+	// so that the Nord can have kids. 
 	isDir  bool
+	// linkTarget is the target of a symlink, as per [os.Readlink],
+	// and linkToDir says whether the target is a directory. For
+	// anything else, they are "" and false. 
+	linkTarget string
+	linkToDir  bool
 	// level is equal to the number of "/" filepath separators
 	// *separating* path elements (i.e. not including any leading 
 	// or trailing separators). Therefore it is 0 for an XML docu-
@@ -128,19 +135,22 @@ type Nord struct {
 	// is >0 for others. Reserve negative numbers for future (ab)use.
 	level int
      	// ----------------------------------
-	//  Temporarily unused: three fields	
+	//  Optional: IDs (see [AssignIDs])
      	// ----------------------------------
 	// seqID is a unique ID under this node's tree's root. It does not 
 	// need to be the same as (say) the index of this Nord in a slice 
 	// of Nord's, but it probably is. Its use is optional, and also 
 	// it can be used in other ways in structs that embed Nord.
-	// >> seqID int
+	// It is 0 if IDs are not used. 
+	seqID int
+	// ids is the registry of IDs of the tree, shared by its Nords.
+	ids *nordIDs
 	// parSeqID and kidSeqID's can add a layer of error checking 
 	// and simplified access. Their use is optional.
 	// kidSeqIds when empty is ",", otherwise e.g. ",1,4,56,". 
 	// the seqIds should (well, can) be in the same order as 
 	// the Kid nodes themselves. The bracketing by commas makes 
-	// searching simpler (",%d,").
+	// searching simpler (",%d,"). (See field kidIdxs.)
 	// >> parSeqID, kidSeqID string
 
 	// ==================================================
@@ -173,6 +183,21 @@ type Nord struct {
 	// Comma-bracketing simplifies search (",%d,").
 	// ------------------------------------------
 	kidIdxs string
+	// kidIdxsToAdd are the IDs of kids that were appended but
+	// are not in kidIdxs yet, so that appending kids one by one
+	// does not rebuild the string each time; see [Nord.KidIDs].
+	kidIdxsToAdd []int
+	// kidCache is the kids (in order), or nil if it has to be
+	// refilled; see [Nord.KidCount]. kidIndex is the index of
+	// this Nord in its parent's kidCache, as of when it was
+	// filled (or last updated in place). Both are guarded
+	// by kidCacheMu.
+	kidCache []Norder
+	kidIndex int
+	// digest is the cached Merkle digest (see [MerkleDigest]),
+	// or nil. If it is set, it is set for all of the descendants
+	// too, and it is dropped whenever the subtree changes.
+	digest *Digest
 
 	// This is a handy utility function, but 
 	// maybe just implementing+using interface
@@ -184,12 +209,24 @@ type Nord struct {
 // to/from a root node have to be explicit.
 type RootNord Nord
 
-// IsDir does NOT work, because we are not setting bool isDir yet.
-// It is set (or not set) in embedding structs.
+// IsDir is true for a Nord that was made from a directory (as by
+// [NewDirTree], [NewFilePropsNord], or [NewRootNord]), and otherwise
+// false, unless it is set by a struct that embeds Nord.
 func (p *Nord) IsDir() bool {
 	return p.isDir
 }
 
+// IsDirlike is true for a dir, or for a symlink to a dir (which 
+// has kids only if it was followed, in which case IsDir is true). 
+func (p *Nord) IsDirlike() bool {
+	return p.isDir || p.linkToDir
+}
+
+// LinkTarget is the target of a symlink, or "" if it is not one. 
+func (p *Nord) LinkTarget() string {
+	return p.linkTarget
+}
+
 // NewRootNord verifies it got a directory, and then sets the bools
 // [isRoot] and [isDir]. Note that the passed-in field [rootPath] is
 // set elsewhere, and must be set in the global [NordEng] before any
@@ -271,25 +308,21 @@ func (p *Nord) IsRoot() bool {
 }
 
 // Root walks the tree upward until [IsRoot] is true,
-// so it does not use any global variables.
+// so it does not use any global variables. If the tree
+// is damaged (see [RootOf]), it logs the error and
+// returns nil.
 func (p *Nord) Root() RootNorder {
 	if p.IsRoot() {
 		return p
 	}
-	var ondr Norder
-	ondr = p
-	for !ondr.IsRoot() {
-		ondr = ondr.Parent()
+	r, e := RootOf(p)
+	if e != nil {
+		L.L.Error(e.Error())
+		return nil
 	}
-	return ondr
+	return r
 }
 
-/*
-// SeqId is duh.
-func (p *Nord) SeqID() int {
-	return p.seqID
-} */
-
 // Level is duh.
 func (p *Nord) Level() int {
 	return p.level
@@ -306,6 +339,21 @@ func (p *Nord) setLevel(i int) {
 	p.level = i
 }
 
+// nord is duh.
+func (p *Nord) nord() *Nord {
+	return p
+}
+
+// sameNord is true if a and b are the same node, even if one of
+// them is a Nord and the other is a struct that embeds it. It is
+// false if either is nil.
+func sameNord(a, b Norder) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a.nord() == b.nord()
+}
+
 // AddKid adds the supplied node as the last kid, and returns
 // it (i.e. the new last kid), now linked into the tree.
 func (pOld *Nord) ReplaceWith(pNew Norder) Norder {
@@ -6,8 +6,10 @@ import (
 
 // Norder is satisfied by [*Nord] NOT by Nord.
 type Norder interface {
-	// SeqID() int
-	// SetSeqID(int)
+	// SeqID is 0 unless the tree has IDs (see [AssignIDs])
+	SeqID() int
+	// ByID finds a Nord in the same tree by its SeqID
+	ByID(int) Norder
 	// Level is zero-based (i.e. root nord's is 0) 
 	Level() int
 	// RelFP is rel.filepath for a file/dir, and for a DOM
@@ -23,7 +25,10 @@ type Norder interface {
 	// Root should always return the root, at arena index 0 
 	Root() RootNorder
 	IsDir() bool
-	// IsDirlike() bool // FIXME: add this!
+	// IsDirlike is true also for a symlink to a dir.
+	IsDirlike() bool
+	// LinkTarget is "" unless it is a symlink.
+	LinkTarget() string
 	Parent() Norder
 	HasKids() bool
 	FirstKid() Norder
@@ -31,6 +36,10 @@ type Norder interface {
 	PrevKid() Norder
 	NextKid() Norder
 	KidsAsSlice() []Norder
+	KidCount() int
+	KidAt(int) Norder
+	IndexInParent() int
+	Siblings() []Norder
 	// AddKid returns the kid, who knows his
 	// own arena index (using [slices.Index])
 	AddKid(Norder) Norder
@@ -49,4 +58,8 @@ type Norder interface {
 	PrintTree(io.Writer) error
 	// PACKAGE METHODS
 	setLevel(int)
+	// nord returns the (embedded) Nord, which is what
+	// identifies a node, because a kid's parent link can
+	// be to the parent's Nord, not to a struct embedding it.
+	nord() *Nord
 }
@@ -0,0 +1,214 @@
+package orderednodes
+
+// This file gives the Nords of a tree stable IDs: sequential numbers
+// (starting at 1, for the root) that are unique within the tree, that
+// are never reused, and that a Nord keeps when its kid list changes
+// or when it is moved within the tree. This lets Nords be correlated
+// with (for example) rows in a database, and lets a tree be checked
+// against the redundant list of kid IDs kept in each Nord's kidIdxs
+// (see [Verify]).
+
+import (
+	"fmt"
+	"strconv"
+	S "strings"
+
+	L "github.com/fbaube/mlog"
+)
+
+// nordIDs is the registry of a tree's IDs, shared by all its Nords.
+type nordIDs struct {
+	last int
+	byID map[int]Norder
+}
+
+// AssignIDs turns on IDs for the tree of root. Every Nord in the
+// tree gets an ID (in preorder), and so does every Nord that is
+// added later using AddKid (or by [Reconcile], and so on). Calling
+// it again is harmless.
+//
+// The structural operations of this package (such as AddKid and
+// [Nord.SortKids]) also keep each Nord's list of its kids' IDs,
+// which [Verify] checks against the kid list. So if Nords are
+// relinked using the Set* methods, it is flagged by Verify.
+// .
+func AssignIDs(root Norder) error {
+	if root == nil || !root.IsRoot() {
+		return fmt.Errorf("AssignIDs: <%s> is not a root: %w", relFP(root), ErrNoRoot)
+	}
+	r := root.nord()
+	if r.ids == nil {
+		r.ids = &nordIDs{byID: make(map[int]Norder)}
+	}
+	if e := r.ids.registerTree(root); e != nil {
+		return fmt.Errorf("AssignIDs: %w", e)
+	}
+	return nil
+}
+
+// SeqID returns the Nord's ID, or 0 if it has none.
+func (p *Nord) SeqID() int {
+	return p.seqID
+}
+
+// ByID returns the Nord in p's tree that has the ID id,
+// or nil if there is none (or if the tree has no IDs).
+func (p *Nord) ByID(id int) Norder {
+	if p.ids == nil {
+		return nil
+	}
+	return p.ids.byID[id]
+}
+
+// KidIDs returns the IDs of p's kids as they are recorded in
+// kidIdxs, like ",1,4,56,", or "" if the tree has no IDs.
+func (p *Nord) KidIDs() string {
+	if p.ids == nil {
+		return ""
+	}
+	return p.kidIdxsNow()
+}
+
+// kidIdxsNow returns kidIdxs plus the IDs that are still to be
+// added to it. It does not modify p, so readers can call it.
+func (p *Nord) kidIdxsNow() string {
+	if len(p.kidIdxsToAdd) == 0 {
+		return p.kidIdxs
+	}
+	var sb S.Builder
+	sb.WriteString(p.kidIdxs)
+	if p.kidIdxs == "" {
+		sb.WriteString(",")
+	}
+	for _, i := range p.kidIdxsToAdd {
+		sb.WriteString(strconv.Itoa(i) + ",")
+	}
+	return sb.String()
+}
+
+// flushKidIdxs adds to kidIdxs the IDs that are still to be added.
+func (p *Nord) flushKidIdxs() {
+	if len(p.kidIdxsToAdd) > 0 {
+		p.setKidIdxs(p.kidIdxsNow())
+	}
+}
+
+// setKidIdxs sets kidIdxs to s, with none still to be added.
+func (p *Nord) setKidIdxs(s string) {
+	p.kidIdxs, p.kidIdxsToAdd = s, nil
+}
+
+// registerTree registers every Nord under (and including) p,
+// and sets their kidIdxs.
+func (ids *nordIDs) registerTree(p Norder) error {
+	return walkLinks(p, ids.register, func(n Norder) {
+		n.nord().setKidIdxs(kidIdxsOf(n))
+	})
+}
+
+// register gives n an ID if it does not have one from this
+// registry, and makes it findable by its ID.
+func (ids *nordIDs) register(n Norder) {
+	nn := n.nord()
+	if nn.ids != ids || nn.seqID == 0 {
+		ids.last++
+		nn.seqID = ids.last
+		nn.ids = ids
+	}
+	ids.byID[nn.seqID] = n
+}
+
+// unregisterTree makes every Nord under (and including) p not
+// findable by its ID. They keep their IDs, in case they are put
+// back in the tree.
+func (ids *nordIDs) unregisterTree(p Norder) {
+	e := walkLinks(p, func(n Norder) {
+		delete(ids.byID, n.nord().seqID)
+	}, nil)
+	if e != nil {
+		L.L.Error(e.Error())
+	}
+}
+
+// walkLinks calls pre and post (if not nil) for every Nord under
+// (and including) p, following the links themselves rather than
+// calling FirstKid, so that it does not read the dirs of any
+// [LazyDirNord]s: their kids get IDs when they are added. It does
+// not recurse, so that a deep subtree can be added in one go.
+func walkLinks(p Norder, pre, post func(Norder)) error {
+	// linkFrame is a Nord whose kids are being visited.
+	type linkFrame struct {
+		n    Norder
+		kids []Norder
+		i    int
+	}
+	pre(p)
+	var stack = []linkFrame{{n: p, kids: p.nord().kids()}}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.i == len(top.kids) {
+			if post != nil {
+				post(top.n)
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		k := top.kids[top.i]
+		top.i++
+		if len(stack) > MaxTreeDepth {
+			return tooDeepError("IDs", k)
+		}
+		pre(k)
+		stack = append(stack, linkFrame{n: k, kids: k.nord().kids()})
+	}
+	return nil
+}
+
+// kidIdxsOf returns the IDs of n's kids, like ",1,4,56,".
+func kidIdxsOf(n Norder) string {
+	var sb S.Builder
+	sb.WriteString(",")
+	for _, k := range n.nord().kids() {
+		sb.WriteString(strconv.Itoa(k.nord().seqID))
+		sb.WriteString(",")
+	}
+	return sb.String()
+}
+
+// idsKidAdded is called when kid has been linked in as p's
+// last kid.
+func (p *Nord) idsKidAdded(kid Norder) {
+	if p.ids == nil {
+		return
+	}
+	if e := p.ids.registerTree(kid); e != nil {
+		L.L.Error(e.Error())
+	}
+	p.kidIdxsToAdd = append(p.kidIdxsToAdd, kid.nord().seqID)
+}
+
+// idsKidInserted is called when kid has been linked
+// in as p's kid, just before the kid before.
+func (p *Nord) idsKidInserted(kid, before Norder) {
+	if p.ids == nil {
+		return
+	}
+	if e := p.ids.registerTree(kid); e != nil {
+		L.L.Error(e.Error())
+	}
+	p.flushKidIdxs()
+	b := "," + strconv.Itoa(before.nord().seqID) + ","
+	k := "," + strconv.Itoa(kid.nord().seqID)
+	p.kidIdxs = S.Replace(p.kidIdxs, b, k+b, 1)
+}
+
+// idsKidRemoved is called when kid has been unlinked from p.
+func (p *Nord) idsKidRemoved(kid Norder) {
+	if p.ids == nil {
+		return
+	}
+	p.ids.unregisterTree(kid)
+	p.flushKidIdxs()
+	k := "," + strconv.Itoa(kid.nord().seqID) + ","
+	p.kidIdxs = S.Replace(p.kidIdxs, k, ",", 1)
+}
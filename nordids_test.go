@@ -0,0 +1,121 @@
+package orderednodes
+
+import (
+	"testing"
+
+	FU "github.com/fbaube/fileutils"
+)
+
+// idsTestTree returns a root with the kids a, b and c, and
+// with IDs assigned: the root is 1, and a, b and c are 2..4.
+func idsTestTree(t *testing.T) *Nord {
+	r := &Nord{relPath: ".", absPath: "/r/", isRoot: true, isDir: true}
+	for _, s := range []string{"a", "b", "c"} {
+		r.AddKid(&Nord{relPath: s, absPath: FU.AbsFilePath("/r/" + s)})
+	}
+	if e := AssignIDs(r); e != nil {
+		t.Fatal(e)
+	}
+	return r
+}
+
+func TestKidIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(r *Nord)
+		want string
+	}{
+		{"assigned", func(*Nord) {}, ",2,3,4,"},
+		{"added", func(r *Nord) {
+			r.AddKid(&Nord{relPath: "d", absPath: "/r/d"})
+			r.AddKid(&Nord{relPath: "e", absPath: "/r/e"})
+		}, ",2,3,4,5,6,"},
+		{"inserted", func(r *Nord) {
+			insertKidBefore(r, &Nord{relPath: "d", absPath: "/r/d"},
+				r.FirstKid().NextKid())
+		}, ",2,5,3,4,"},
+		{"added then inserted", func(r *Nord) {
+			r.AddKid(&Nord{relPath: "d", absPath: "/r/d"})
+			insertKidBefore(r, &Nord{relPath: "e", absPath: "/r/e"},
+				r.LastKid())
+		}, ",2,3,4,6,5,"},
+		{"removed", func(r *Nord) {
+			removeKid(r, r.FirstKid().NextKid())
+		}, ",2,4,"},
+		{"added then removed", func(r *Nord) {
+			r.AddKid(&Nord{relPath: "d", absPath: "/r/d"})
+			removeKid(r, r.FirstKid())
+		}, ",3,4,5,"},
+		{"removed all", func(r *Nord) {
+			for r.FirstKid() != nil {
+				removeKid(r, r.FirstKid())
+			}
+		}, ","},
+		{"sorted", func(r *Nord) {
+			r.SortKids(func(a, b Norder) int { return -LexicalOrder(a, b) })
+		}, ",4,3,2,"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := idsTestTree(t)
+			tc.op(r)
+			if got := r.KidIDs(); got != tc.want {
+				t.Errorf("KidIDs: got %q, want %q", got, tc.want)
+			}
+			if vv := Verify(r); len(vv) > 0 {
+				t.Errorf("Verify: %v", vv)
+			}
+		})
+	}
+}
+
+func TestByID(t *testing.T) {
+	r := idsTestTree(t)
+	b := r.FirstKid().NextKid()
+	b.AddKid(&Nord{relPath: "b/x", absPath: "/r/b/x"})
+	removeKid(r, r.LastKid())
+	tests := []struct {
+		id   int
+		want string // the relPath, or "" for none
+	}{
+		{1, "."},
+		{2, "a"},
+		{3, "b"},
+		{4, ""}, // removed
+		{5, "b/x"},
+		{6, ""},
+		{0, ""},
+	}
+	for _, tc := range tests {
+		got := r.ByID(tc.id)
+		if got == nil && tc.want != "" ||
+			got != nil && got.RelFP() != tc.want {
+			t.Errorf("ByID(%d): got <%s>, want <%s>",
+				tc.id, relFP(got), tc.want)
+		}
+		if got != nil && got.SeqID() != tc.id {
+			t.Errorf("ByID(%d): has ID %d", tc.id, got.SeqID())
+		}
+	}
+	if n := (&Nord{}).ByID(1); n != nil {
+		t.Errorf("ByID without IDs: got <%s>", n.RelFP())
+	}
+}
+
+func TestAssignIDsDeep(t *testing.T) {
+	// A long chain of dirs, which is walked without recursion.
+	r := &Nord{relPath: ".", absPath: "/r/", isRoot: true, isDir: true}
+	var p Norder = r
+	for i := 0; i < 100000; i++ {
+		p = p.AddKid(&Nord{relPath: "d", absPath: "/r/d", isDir: true})
+	}
+	if e := AssignIDs(r); e != nil {
+		t.Fatal(e)
+	}
+	if got := p.SeqID(); got != 100001 {
+		t.Errorf("deepest ID: got %d, want 100001", got)
+	}
+	if got := p.Parent().nord().KidIDs(); got != ",100001," {
+		t.Errorf("KidIDs of the deepest dir: got %q", got)
+	}
+}
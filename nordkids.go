@@ -3,6 +3,10 @@ package orderednodes
 import (
 	"fmt"
 	"os"
+	"slices"
+	"sync"
+
+	L "github.com/fbaube/mlog"
 )
 
 // HasKids is duh.
@@ -15,40 +19,62 @@ func (p *Nord) Parent() Norder {
 	return p.parent
 }
 
-// SetParent has no side effects.
+// SetParent has no side effects (other than on the
+// parents' caches of kids, and their cached digests).
 func (p *Nord) SetParent(p2 Norder) {
+	p.dropParentsKidCache()
 	p.parent = p2
+	p.dropParentsKidCache()
 }
 
-// SetPrevKid has no side effects.
+// SetPrevKid has no side effects (other than on the
+// parent's cache of kids, and its cached digest).
 func (p *Nord) SetPrevKid(p2 Norder) {
 	p.prevKid = p2
+	p.dropParentsKidCache()
 }
 
-// SetNextKid has no side effects.
+// SetNextKid has no side effects (other than on the
+// parent's cache of kids, and its cached digest).
 func (p *Nord) SetNextKid(p2 Norder) {
 	p.nextKid = p2
+	p.dropParentsKidCache()
 }
 
-// SetFirstKid has no side effects.
+// SetFirstKid has no side effects (other than on
+// the cache of kids, and the cached digest).
 func (p *Nord) SetFirstKid(p2 Norder) {
 	p.firstKid = p2
+	p.dropKidCache()
+	p.dropDigests()
 }
 
-// SetLastKid has no side effects.
+// SetLastKid has no side effects (other than on
+// the cache of kids, and the cached digest).
 func (p *Nord) SetLastKid(p2 Norder) {
 	p.lastKid = p2
+	p.dropKidCache()
+	p.dropDigests()
 }
 
 // AddKid adds the supplied node as the last kid, and returns
 // it (i.e. the new last kid), now linked into the tree.
 func (p *Nord) AddKid(aKid Norder) Norder { // returns aKid
+	return linkKid(p, aKid)
+}
+
+// linkKid does AddKid for par, which is the Norder that embeds the
+// Nord (if any), such as a *Node[T], so that the kid's parent link
+// is to par itself, and so Parent returns the embedding type. An
+// embedding type's AddKid and AddKids call linkKid and linkKids.
+func linkKid(par Norder, aKid Norder) Norder { // returns aKid
+	p := par.nord()
 	// fmt.Printf("nord: ptrs? aKid<%T> p<%T> \n", aKid, p)
 	if aKid.PrevKid() != nil || aKid.NextKid() != nil {
 		fmt.Fprintf(os.Stdout, "FATAL in AddKid: Tag<< %+v >> kid<< %+v >>\n", p, aKid)
 		panic("AddKid(K) can't cos K has siblings")
 	}
-	if aKid.Parent() != nil && aKid.Parent() != p {
+	if aKid.Parent() != nil && !sameNord(aKid.Parent(), p) {
 		fmt.Fprintf(os.Stdout, "FATAL in AddKid: Tag<< %+v >> kid<< %+v >>\n", p, aKid)
 		panic("E.AddKid(K) can't cos K has non-P parent")
 	}
@@ -56,12 +82,16 @@ func (p *Nord) AddKid(aKid Norder) Norder { // returns aKid
 	var LK = p.lastKid
 	// Set the level now
 	aKid.setLevel(p.Level() + 1)
+	// Keep the cache of kids (if any) by appending to it.
+	var cache = p.kidCacheNow()
 	// Is the new kid an only kid ?
 	if FK == nil && LK == nil {
 		p.firstKid, p.lastKid = aKid, aKid
-		aKid.SetParent(p)
+		aKid.SetParent(par)
 		aKid.SetPrevKid(nil)
 		aKid.SetNextKid(nil)
+		p.appendToKidCache(cache, aKid)
+		p.idsKidAdded(aKid)
 		return aKid
 	}
 	if !(FK != nil && LK != nil) {
@@ -69,7 +99,7 @@ func (p *Nord) AddKid(aKid Norder) Norder { // returns aKid
 	}
 	// So, replace the last kid
 	if LK != nil {
-		if LK.Parent() != p {
+		if !sameNord(LK.Parent(), p) {
 			fmt.Fprintf(os.Stdout, "FATAL in AddKid: E<< %+v >> K<< %+v >>\n", p, aKid)
 			panic("E.AddKid: E's last kid dusnt know E")
 		}
@@ -80,7 +110,9 @@ func (p *Nord) AddKid(aKid Norder) Norder { // returns aKid
 		LK.SetNextKid(aKid) // LK.nextKid = aKid
 		aKid.SetPrevKid(LK) // aKid.prevKid = LK
 		p.lastKid = aKid
-		aKid.SetParent(p)
+		aKid.SetParent(par)
+		p.appendToKidCache(cache, aKid)
+		p.idsKidAdded(aKid)
 		return aKid
 	}
 	fmt.Fprintf(os.Stdout, "FATAL in AddKid: E<< %+v >> K<< %+v >>\n", p, aKid)
@@ -90,19 +122,7 @@ func (p *Nord) AddKid(aKid Norder) Norder { // returns aKid
 // AddKids adds the supplied nodes as kids, after any pre-existing
 // kids, and returns the parent. 
 func (p *Nord) AddKids(rKids []Norder) Norder { // returns p 
-	// fmt.Printf("nord: ptrs? aKid<%T> p<%T> \n", aKid, p)
-	for _, aKid := range rKids {	
-	    if aKid.PrevKid() != nil || aKid.NextKid() != nil {
-		fmt.Fprintf(os.Stdout, "FATAL in AddKids: Tag<< %+v >> kid<< %+v >>\n", p, aKid)
-		panic("AddKids(K) can't cos K has siblings")
-		}
-	    if aKid.Parent() != nil && aKid.Parent() != p {
-		fmt.Fprintf(os.Stdout, "FATAL in AddKids: Tag<< %+v >> kid<< %+v >>\n", p, aKid)
-		panic("E.AddKids(K) can't cos K has non-P parent")
-		}
-	    // All clear! Go ahead and add the kid.
-	    _ = p.AddKid(aKid)
-	}
+	linkKids(p, rKids)
 	/*
 	var FK = p.firstKid
 	var LK = p.lastKid
@@ -144,6 +164,24 @@ func (p *Nord) AddKids(rKids []Norder) Norder { // returns p
 	return p
 }
 
+// linkKids does AddKids for par, as linkKid does AddKid.
+func linkKids(par Norder, rKids []Norder) {
+	p := par.nord()
+	// fmt.Printf("nord: ptrs? aKid<%T> p<%T> \n", aKid, p)
+	for _, aKid := range rKids {	
+	    if aKid.PrevKid() != nil || aKid.NextKid() != nil {
+		fmt.Fprintf(os.Stdout, "FATAL in AddKids: Tag<< %+v >> kid<< %+v >>\n", p, aKid)
+		panic("AddKids(K) can't cos K has siblings")
+		}
+	    if aKid.Parent() != nil && !sameNord(aKid.Parent(), p) {
+		fmt.Fprintf(os.Stdout, "FATAL in AddKids: Tag<< %+v >> kid<< %+v >>\n", p, aKid)
+		panic("E.AddKids(K) can't cos K has non-P parent")
+		}
+	    // All clear! Go ahead and add the kid.
+	    _ = linkKid(par, aKid)
+	}
+}
+
 // FirstKid provides read-only access for other packages. Can return nil.
 func (p *Nord) FirstKid() Norder {
 	return p.firstKid
@@ -164,12 +202,245 @@ func (p *Nord) NextKid() Norder {
 	return p.nextKid
 }
 
+// KidsAsSlice returns the kids in order, in a new slice. If the kid
+// list loops, it logs an error and returns the kids up to the loop.
+//
+// Unlike [Nord.KidCount], it does not fill the cache of kids (it
+// only reads it).
+// .
 func (p *Nord) KidsAsSlice() []Norder {
+	if cache := p.kidCacheNow(); cache != nil {
+		return slices.Clone(cache)
+	}
+	return p.linkedKids(false)
+}
+
+// kidCacheMu guards the caches of kids (kidCache, and kidIndex) of
+// all Nords, because they are filled by methods that only read the
+// tree, such as KidCount, and so by concurrent readers. The slice of
+// a cache is modified in place only by changes to the kid list, and
+// so not while there are readers.
+var kidCacheMu sync.Mutex
+
+// kidCacheNow returns the cache of kids, which is nil if it is not
+// valid. It must not be modified.
+func (p *Nord) kidCacheNow() []Norder {
+	kidCacheMu.Lock()
+	defer kidCacheMu.Unlock()
+	return p.kidCache
+}
+
+// dropKidCache drops the cache of kids.
+func (p *Nord) dropKidCache() {
+	kidCacheMu.Lock()
+	p.kidCache = nil
+	kidCacheMu.Unlock()
+}
+
+// kids returns the cache of kids, filling it if it is not
+// valid. It must not be modified.
+//
+// The cache is dropped by any change to the kid list made using the
+// Set* methods, but AddKid appends to it, and insertKidBefore and
+// removeKid update it in place, so building or reconciling a tree
+// does not drop it. So, reading it is O(1), except for the first
+// read after the kid links are set directly, which is O(n) in the
+// number of kids.
+func (p *Nord) kids() []Norder {
+	kidCacheMu.Lock()
+	defer kidCacheMu.Unlock()
+	return p.kidsLocked()
+}
+
+// kidsLocked is kids, for when kidCacheMu is held.
+func (p *Nord) kidsLocked() []Norder {
+	if p.kidCache != nil || p.firstKid == nil {
+		return p.kidCache
+	}
+	p.kidCache = p.linkedKids(true)
+	return p.kidCache
+}
+
+// linkedKids follows the kid links to list the kids, and if
+// setIndex, sets the kidIndex of each. If the kid list loops,
+// it logs an error and returns the kids up to the loop.
+func (p *Nord) linkedKids(setIndex bool) []Norder {
 	var pp []Norder
+	var g loopGuard
 	c := p.FirstKid() // p.firstKid
 	for c != nil {
+		if g.loops(c) {
+			L.L.Error(kidLoopError("KidsAsSlice", p, c).Error())
+			break
+		}
+		if setIndex {
+			c.nord().kidIndex = len(pp)
+		}
 		pp = append(pp, c)
 		c = c.NextKid() // c.nextKid
 	}
 	return pp
 }
+
+// appendToKidCache sets the cache of kids to the old cache
+// plus kid, if the old cache was valid (or kid is the only kid).
+func (p *Nord) appendToKidCache(old []Norder, kid Norder) {
+	if old == nil && !sameNord(p.firstKid, kid) {
+		return
+	}
+	kidCacheMu.Lock()
+	defer kidCacheMu.Unlock()
+	kid.nord().kidIndex = len(old)
+	p.kidCache = append(old, kid)
+}
+
+// insertIntoKidCache sets the cache of kids to the old cache with
+// kid inserted just before the kid before, if the old cache was
+// valid, and updates the kidIndex of the kids that move.
+func (p *Nord) insertIntoKidCache(old []Norder, kid, before Norder) {
+	kidCacheMu.Lock()
+	defer kidCacheMu.Unlock()
+	i := before.nord().kidIndex
+	if old == nil || i >= len(old) || !sameNord(old[i], before) {
+		return
+	}
+	cache := slices.Insert(old, i, kid)
+	for ; i < len(cache); i++ {
+		cache[i].nord().kidIndex = i
+	}
+	p.kidCache = cache
+}
+
+// removeFromKidCache sets the cache of kids to the old cache without
+// kid, if the old cache was valid, and updates the kidIndex of the
+// kids that move.
+func (p *Nord) removeFromKidCache(old []Norder, kid Norder) {
+	kidCacheMu.Lock()
+	defer kidCacheMu.Unlock()
+	i := kid.nord().kidIndex
+	if old == nil || i >= len(old) || !sameNord(old[i], kid) {
+		return
+	}
+	cache := slices.Delete(old, i, i+1)
+	for ; i < len(cache); i++ {
+		cache[i].nord().kidIndex = i
+	}
+	if len(cache) > 0 {
+		p.kidCache = cache
+	}
+}
+
+// dropParentsKidCache drops the cache of kids of p's
+// parent, and the cached digests of it and its ancestors.
+func (p *Nord) dropParentsKidCache() {
+	if p.parent != nil {
+		p.parent.nord().dropKidCache()
+		p.parent.nord().dropDigests()
+	}
+}
+
+// KidCount returns the number of kids.
+//
+// KidCount, KidAt, IndexInParent and Siblings use a cache of the kid
+// list, so they are O(1) (amortized). The cache is guarded by a lock,
+// so they are safe to call concurrently, if nothing modifies the tree.
+// .
+func (p *Nord) KidCount() int {
+	return len(p.kids())
+}
+
+// KidAt returns the kid at (zero-based) index i, or nil if there is none.
+func (p *Nord) KidAt(i int) Norder {
+	kk := p.kids()
+	if i < 0 || i >= len(kk) {
+		return nil
+	}
+	return kk[i]
+}
+
+// IndexInParent returns the (zero-based) index of p among its
+// parent's kids, or -1 if it has no parent (or is not in the
+// parent's kid list).
+func (p *Nord) IndexInParent() int {
+	if p.parent == nil {
+		return -1
+	}
+	par := p.parent.nord()
+	kidCacheMu.Lock()
+	defer kidCacheMu.Unlock()
+	kk := par.kidsLocked()
+	if i := p.kidIndex; i < len(kk) && kk[i].nord() == p {
+		return i
+	}
+	// The index is stale: it is set when the cache is filled.
+	par.kidCache = nil
+	kk = par.kidsLocked()
+	if i := p.kidIndex; i < len(kk) && kk[i].nord() == p {
+		return i
+	}
+	return -1
+}
+
+// Siblings returns the parent's other kids, in order, in a new
+// slice, or nil if there is no parent.
+func (p *Nord) Siblings() []Norder {
+	if p.parent == nil {
+		return nil
+	}
+	kk := p.parent.nord().kids()
+	var ss = make([]Norder, 0, max(len(kk)-1, 0))
+	for _, k := range kk {
+		if k.nord() != p {
+			ss = append(ss, k)
+		}
+	}
+	return ss
+}
+
+// insertKidBefore links kid into p's kid list just before the kid
+// before, or at the end if before is nil. kid must have no links.
+func insertKidBefore(p, kid, before Norder) {
+	if before == nil {
+		// Not p.AddKid, which (for a LazyDirNord) reads the dir.
+		linkKid(p, kid)
+		return
+	}
+	// Keep the cache of kids (if any) by inserting into it.
+	var cache = p.nord().kidCacheNow()
+	kid.setLevel(p.Level() + 1)
+	kid.SetParent(p)
+	prev := before.PrevKid()
+	kid.SetPrevKid(prev)
+	kid.SetNextKid(before)
+	before.SetPrevKid(kid)
+	if prev == nil {
+		p.SetFirstKid(kid)
+	} else {
+		prev.SetNextKid(kid)
+	}
+	p.nord().insertIntoKidCache(cache, kid, before)
+	p.nord().idsKidInserted(kid, before)
+}
+
+// removeKid unlinks kid (and so its subtree) from p's kid
+// list, and clears kid's parent and sibling links.
+func removeKid(p, kid Norder) {
+	// Keep the cache of kids (if any) by deleting from it.
+	var cache = p.nord().kidCacheNow()
+	prev, next := kid.PrevKid(), kid.NextKid()
+	if prev == nil {
+		p.SetFirstKid(next)
+	} else {
+		prev.SetNextKid(next)
+	}
+	if next == nil {
+		p.SetLastKid(prev)
+	} else {
+		next.SetPrevKid(prev)
+	}
+	kid.SetParent(nil)
+	kid.SetPrevKid(nil)
+	kid.SetNextKid(nil)
+	p.nord().removeFromKidCache(cache, kid)
+	p.nord().idsKidRemoved(kid)
+}
@@ -0,0 +1,137 @@
+package orderednodes
+
+import (
+	S "strings"
+	"testing"
+)
+
+// kidsTestTree returns a root with the kids a to e.
+func kidsTestTree() *Nord {
+	r := &Nord{relPath: ".", absPath: "/r/", isRoot: true, isDir: true}
+	for _, s := range []string{"a", "b", "c", "d", "e"} {
+		r.AddKid(&Nord{relPath: s})
+	}
+	return r
+}
+
+// kidByName returns the kid of r whose relPath is s.
+func kidByName(r Norder, s string) Norder {
+	for k := r.FirstKid(); k != nil; k = k.NextKid() {
+		if k.RelFP() == s {
+			return k
+		}
+	}
+	return nil
+}
+
+func TestKidAccessAfterMoves(t *testing.T) {
+	tests := []struct {
+		name string
+		move func(r *Nord)
+		want string
+	}{
+		{"none", func(*Nord) {}, "a b c d e"},
+		{"append", func(r *Nord) {
+			r.AddKid(&Nord{relPath: "f"})
+		}, "a b c d e f"},
+		{"insert", func(r *Nord) {
+			insertKidBefore(r, &Nord{relPath: "x"}, kidByName(r, "c"))
+		}, "a b x c d e"},
+		{"insert first", func(r *Nord) {
+			insertKidBefore(r, &Nord{relPath: "x"}, r.FirstKid())
+		}, "x a b c d e"},
+		{"remove first", func(r *Nord) {
+			removeKid(r, r.FirstKid())
+		}, "b c d e"},
+		{"remove last", func(r *Nord) {
+			removeKid(r, r.LastKid())
+		}, "a b c d"},
+		{"remove all", func(r *Nord) {
+			for r.FirstKid() != nil {
+				removeKid(r, r.FirstKid())
+			}
+		}, ""},
+		{"move back", func(r *Nord) {
+			d := kidByName(r, "d")
+			removeKid(r, d)
+			insertKidBefore(r, d, kidByName(r, "b"))
+		}, "a d b c e"},
+		{"move to the end", func(r *Nord) {
+			a := r.FirstKid()
+			removeKid(r, a)
+			insertKidBefore(r, a, nil)
+		}, "b c d e a"},
+		{"sort", func(r *Nord) {
+			r.SortKids(func(a, b Norder) int { return -LexicalOrder(a, b) })
+		}, "e d c b a"},
+		{"relink", func(r *Nord) {
+			// Swap b and c, using only the Set* methods.
+			a, b, c, d := r.FirstKid(), kidByName(r, "b"),
+				kidByName(r, "c"), kidByName(r, "d")
+			a.SetNextKid(c)
+			c.SetPrevKid(a)
+			c.SetNextKid(b)
+			b.SetPrevKid(c)
+			b.SetNextKid(d)
+			d.SetPrevKid(b)
+		}, "a c b d e"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := kidsTestTree()
+			// Fill the caches first, so that the move has to keep
+			// them right (or drop them).
+			r.KidCount()
+			for k := r.FirstKid(); k != nil; k = k.NextKid() {
+				k.nord().IndexInParent()
+			}
+			tc.move(r)
+			want := S.Fields(tc.want)
+			if n := r.KidCount(); n != len(want) {
+				t.Errorf("KidCount: got %d, want %d", n, len(want))
+			}
+			for i, s := range want {
+				k := r.KidAt(i)
+				if k == nil || k.RelFP() != s {
+					t.Errorf("KidAt(%d): got <%s>, want <%s>", i, relFP(k), s)
+					continue
+				}
+				if j := k.nord().IndexInParent(); j != i {
+					t.Errorf("<%s>.IndexInParent: got %d, want %d", s, j, i)
+				}
+				var ss []string
+				for _, sib := range k.nord().Siblings() {
+					ss = append(ss, sib.RelFP())
+				}
+				wantSibs := S.Join(S.Fields(S.Replace(" "+tc.want+" ",
+					" "+s+" ", " ", 1)), " ")
+				if got := S.Join(ss, " "); got != wantSibs {
+					t.Errorf("<%s>.Siblings: got %q, want %q", s, got, wantSibs)
+				}
+			}
+			for _, i := range []int{-1, len(want)} {
+				if k := r.KidAt(i); k != nil {
+					t.Errorf("KidAt(%d): got <%s>", i, k.RelFP())
+				}
+			}
+		})
+	}
+}
+
+func TestIndexInParentRemoved(t *testing.T) {
+	r := kidsTestTree()
+	c := kidByName(r, "c").nord()
+	if i := c.IndexInParent(); i != 2 {
+		t.Fatalf("got %d, want 2", i)
+	}
+	removeKid(r, c)
+	if i := c.IndexInParent(); i != -1 {
+		t.Errorf("after removal: got %d, want -1", i)
+	}
+	if ss := c.Siblings(); ss != nil {
+		t.Errorf("Siblings after removal: got %d", len(ss))
+	}
+	if i := r.IndexInParent(); i != -1 {
+		t.Errorf("root: got %d, want -1", i)
+	}
+}
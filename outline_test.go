@@ -0,0 +1,170 @@
+package orderednodes
+
+import (
+	"bytes"
+	"slices"
+	S "strings"
+	"testing"
+)
+
+// outlineDump lists the title and target of each Nord under root
+// (not root itself), indented by its depth, in preorder.
+func outlineDump(root Norder) []string {
+	var out []string
+	var depth int
+	InspectTreeWithPreAndPost(root,
+		func(n Norder) error {
+			if depth > 0 {
+				title, href := tocTitleAndHref(n)
+				out = append(out, S.Repeat("  ", depth-1)+title+"|"+href)
+			}
+			depth++
+			return nil
+		},
+		func(n Norder) error {
+			depth--
+			return nil
+		})
+	return out
+}
+
+func TestYamlOutlineRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"mkdocs nav", `
+site_name: x
+nav:
+  - index.md
+  - Home: home.md
+  - User Guide:
+      - Writing: guide/writing.md
+      - guide/styling.md
+  - Ext: https://example.com/a
+`, []string{
+			"|index.md",
+			"Home|home.md",
+			"User Guide|",
+			"  Writing|guide/writing.md",
+			"  |guide/styling.md",
+			"Ext|https://example.com/a",
+		}},
+		{"bare list", "- a.md\n- B: b.md\n", []string{
+			"|a.md",
+			"B|b.md",
+		}},
+		{"section index", `
+- Guide:
+    - guide/index.md
+    - Writing: guide/writing.md
+`, []string{
+			"Guide|guide/index.md",
+			"  Writing|guide/writing.md",
+		}},
+		{"untitled first kid", `
+- Guide:
+    - "": guide/first.md
+    - guide/second.md
+`, []string{
+			"Guide|",
+			"  |guide/first.md",
+			"  |guide/second.md",
+		}},
+		{"nested sections", `
+- A:
+    - a/index.md
+    - B:
+        - C: a/b/c.md
+`, []string{
+			"A|a/index.md",
+			"  B|",
+			"    C|a/b/c.md",
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, e := ReadYamlOutline(S.NewReader(tc.src), "/d/mkdocs.yml")
+			if e != nil {
+				t.Fatal(e)
+			}
+			if got := outlineDump(r); !slices.Equal(got, tc.want) {
+				t.Fatalf("read: got %q, want %q", got, tc.want)
+			}
+			var buf bytes.Buffer
+			if e := WriteYamlOutline(&buf, r); e != nil {
+				t.Fatal(e)
+			}
+			r2, e := ReadYamlOutline(&buf, "/d/mkdocs.yml")
+			if e != nil {
+				t.Fatal(e)
+			}
+			if got := outlineDump(r2); !slices.Equal(got, tc.want) {
+				t.Errorf("round trip: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTomlOutlineRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"flat", `
+[[menu.main]]
+  name = "Home"
+  pageRef = "/"
+[[menu.main]]
+  name = "Ext"
+  url = "https://example.com"
+`, []string{
+			"Home|/",
+			"Ext|https://example.com",
+		}},
+		{"kid before parent", `
+[[menu.main]]
+  name = "Writing"
+  pageRef = "guide/writing.md"
+  parent = "guide"
+[[menu.main]]
+  identifier = "guide"
+  name = "User Guide"
+  url = "/guide/"
+`, []string{
+			"User Guide|/guide/",
+			"  Writing|guide/writing.md",
+		}},
+		{"menus", `
+[[menus.main]]
+  name = "A"
+  pageRef = "a.md"
+`, []string{
+			"A|a.md",
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, e := ReadTomlOutline(S.NewReader(tc.src), "/d/hugo.toml", "main")
+			if e != nil {
+				t.Fatal(e)
+			}
+			if got := outlineDump(r); !slices.Equal(got, tc.want) {
+				t.Fatalf("read: got %q, want %q", got, tc.want)
+			}
+			var buf bytes.Buffer
+			if e := WriteTomlOutline(&buf, r, "main"); e != nil {
+				t.Fatal(e)
+			}
+			r2, e := ReadTomlOutline(&buf, "/d/hugo.toml", "main")
+			if e != nil {
+				t.Fatal(e)
+			}
+			if got := outlineDump(r2); !slices.Equal(got, tc.want) {
+				t.Errorf("round trip: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
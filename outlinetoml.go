@@ -0,0 +1,203 @@
+package orderednodes
+
+// This file reads and writes TOML outlines in the style of Hugo menus,
+// which are flat lists of entries that refer to their parent entries:
+//
+//	[[menu.main]]
+//	  identifier = "guide"
+//	  name = "User Guide"
+//	  url = "/guide/"
+//	[[menu.main]]
+//	  name = "Writing"
+//	  pageRef = "guide/writing.md"
+//	  parent = "guide"
+//
+// The list can also be under "menus.main", or (as in a Hugo config
+// file "menus.toml") directly under "main".
+//
+// On input, entries are kept in file order; Hugo's "weight" is ignored.
+// On output, weights are written in steps of 10, in kid order, so that
+// Hugo shows the entries in the same order as the tree.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	FP "path/filepath"
+	S "strings"
+
+	"github.com/BurntSushi/toml"
+	L "github.com/fbaube/mlog"
+)
+
+// hugoMenuEntry is the subset of a Hugo menu entry that we use.
+type hugoMenuEntry struct {
+	Identifier string `toml:"identifier,omitempty"`
+	Name       string `toml:"name"`
+	PageRef    string `toml:"pageRef,omitempty"`
+	URL        string `toml:"url,omitempty"`
+	Parent     string `toml:"parent,omitempty"`
+	Weight     int    `toml:"weight,omitempty"`
+}
+
+// ReadTomlOutline reads the Hugo-style menu named menu (e.g. "main")
+// from a TOML document and returns it as a tree of [*TocNord]. Relative
+// targets are resolved w.r.t. the directory of docPath, which is also
+// the root's path. An entry whose parent cannot be found is logged and
+// added to the root.
+// .
+func ReadTomlOutline(r io.Reader, docPath, menu string) (*TocNord, error) {
+	var doc struct {
+		Menu  map[string][]hugoMenuEntry `toml:"menu"`
+		Menus map[string][]hugoMenuEntry `toml:"menus"`
+	}
+	bb, e := io.ReadAll(r)
+	if e != nil {
+		return nil, fmt.Errorf("ReadTomlOutline: %w", e)
+	}
+	var entries []hugoMenuEntry
+	if _, e = toml.Decode(string(bb), &doc); e == nil {
+		entries = doc.Menu[menu]
+		if entries == nil {
+			entries = doc.Menus[menu]
+		}
+	}
+	if entries == nil {
+		var flat map[string][]hugoMenuEntry
+		if _, e = toml.Decode(string(bb), &flat); e != nil {
+			return nil, fmt.Errorf("ReadTomlOutline: %w", e)
+		}
+		entries = flat[menu]
+	}
+	if entries == nil {
+		return nil, fmt.Errorf("ReadTomlOutline: no menu %q", menu)
+	}
+	root := NewRootTocNord(docPath)
+	// Hugo lets an entry precede its parent, so first make them
+	// all, then link them up in file order.
+	var nords = make([]*TocNord, len(entries))
+	var byID = make(map[string]int)
+	for i, ent := range entries {
+		id := ent.Identifier
+		if id == "" {
+			id = ent.Name
+		}
+		if _, dupe := byID[id]; dupe {
+			return nil, fmt.Errorf("ReadTomlOutline: duplicate "+
+				"menu entry identifier %q", id)
+		}
+		byID[id] = i
+	}
+	var linked = make([]bool, len(entries))
+	var link func(i int, path []int) error
+	link = func(i int, path []int) error {
+		if linked[i] {
+			return nil
+		}
+		for _, j := range path {
+			if j == i {
+				return errors.New("ReadTomlOutline: menu entry " +
+					"parents form a cycle at " + entries[i].Name)
+			}
+		}
+		var par Norder = root
+		if pid := entries[i].Parent; pid != "" {
+			if j, ok := byID[pid]; ok {
+				if e := link(j, append(path, i)); e != nil {
+					return e
+				}
+				par = nords[j]
+			} else {
+				L.L.Warning("ReadTomlOutline: menu entry %q "+
+					"has unknown parent %q", entries[i].Name, pid)
+			}
+		}
+		href := entries[i].PageRef
+		if href == "" {
+			href = entries[i].URL
+		}
+		nords[i] = NewTocNord(par, entries[i].Name, href, docPath)
+		nords[i].fromURL = entries[i].PageRef == "" && href != ""
+		linked[i] = true
+		return nil
+	}
+	for i := range entries {
+		if e := link(i, nil); e != nil {
+			return nil, e
+		}
+	}
+	// Now add kids in file order.
+	for i, n := range nords {
+		var par Norder = root
+		if j, ok := byID[entries[i].Parent]; ok && entries[i].Parent != "" {
+			par = nords[j]
+		}
+		par.AddKid(n)
+	}
+	// AddKid set each entry's level from its parent's as it was
+	// then, which is too low if the parent was linked after it.
+	e = InspectTree(root, func(p Norder) error {
+		if par := p.Parent(); par != nil {
+			p.setLevel(par.Level() + 1)
+		}
+		return nil
+	})
+	if e != nil {
+		return nil, fmt.Errorf("ReadTomlOutline: %w", e)
+	}
+	return root, nil
+}
+
+// WriteTomlOutline writes the tree under root as the Hugo-style menu
+// named menu (e.g. "main"), under the table "menu". Each entry's
+// identifier is its relPath, which is unique unless there are same-
+// named siblings. Titles and targets are found as for [WriteYamlOutline].
+// A target is written as a url if it was read from one (by
+// [ReadTomlOutline]) or is external (like "https://..."), and
+// otherwise as a pageRef.
+// .
+func WriteTomlOutline(w io.Writer, root Norder, menu string) error {
+	var entries []hugoMenuEntry
+	var weights = make(map[Norder]int)
+	e := InspectTree(root, func(p Norder) error {
+		if p == root {
+			return nil
+		}
+		title, href := tocTitleAndHref(p)
+		ent := hugoMenuEntry{
+			Identifier: FP.ToSlash(p.RelFP()),
+			Name:       title,
+		}
+		if hugoHrefIsURL(p, href) {
+			ent.URL = href
+		} else {
+			ent.PageRef = href
+		}
+		if par := p.Parent(); par != nil && !par.IsRoot() {
+			ent.Parent = FP.ToSlash(par.RelFP())
+		}
+		weights[p.Parent()] += 10
+		ent.Weight = weights[p.Parent()]
+		entries = append(entries, ent)
+		return nil
+	})
+	if e != nil {
+		return fmt.Errorf("WriteTomlOutline: %w", e)
+	}
+	doc := map[string]map[string][]hugoMenuEntry{
+		"menu": {menu: entries},
+	}
+	if e = toml.NewEncoder(w).Encode(doc); e != nil {
+		return fmt.Errorf("WriteTomlOutline: %w", e)
+	}
+	return nil
+}
+
+// hugoHrefIsURL is true if href (the target of p)
+// should be written as a url, rather than a pageRef.
+func hugoHrefIsURL(p Norder, href string) bool {
+	if tn, ok := p.(*TocNord); ok && tn.fromURL {
+		return true
+	}
+	return S.Contains(href, "://") || S.HasPrefix(href, "mailto:")
+}
@@ -0,0 +1,181 @@
+package orderednodes
+
+// This file reads and writes nested YAML outlines, in the style of
+// the mkdocs `nav:` setting:
+//
+//	nav:
+//	  - index.md
+//	  - Home: home.md
+//	  - User Guide:
+//	      - Writing: guide/writing.md
+//	      - guide/styling.md
+//
+// An entry is either a bare target, or a one-key mapping from a title
+// to either a target (for a leaf) or a list of entries (for a section).
+// Entry order is preserved in both directions.
+//
+// A section's own target is its list's first entry, if that is a bare
+// target, as for the section index pages of mkdocs-material:
+//
+//	  - User Guide:
+//	      - guide/index.md
+//	      - Writing: guide/writing.md
+//
+// So an untitled first kid of a section is written with an empty
+// title (as `"": guide/first.md`), so that it is read back as a kid.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	FP "path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ReadYamlOutline reads a YAML outline (either a bare list of entries,
+// or a mapping with the list under the key "nav") and returns it as a
+// tree of [*TocNord]. Relative targets are resolved w.r.t. the directory
+// of docPath, which is also the root's path.
+// .
+func ReadYamlOutline(r io.Reader, docPath string) (*TocNord, error) {
+	bb, e := io.ReadAll(r)
+	if e != nil {
+		return nil, fmt.Errorf("ReadYamlOutline: %w", e)
+	}
+	// A bare list is tried first, because a list of
+	// mappings also decodes (wrongly) as a MapSlice.
+	var entries []interface{}
+	if e = yaml.Unmarshal(bb, &entries); e != nil {
+		// Decoding into a MapSlice makes nested mappings
+		// decode as MapSlices too, which preserves order.
+		var ms yaml.MapSlice
+		if e = yaml.Unmarshal(bb, &ms); e != nil {
+			return nil, fmt.Errorf("ReadYamlOutline: %w", e)
+		}
+		var found bool
+		for _, item := range ms {
+			if k, ok := item.Key.(string); ok && k == "nav" {
+				if entries, ok = item.Value.([]interface{}); !ok {
+					return nil, errors.New(
+						"ReadYamlOutline: \"nav\" is not a list")
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("ReadYamlOutline: no \"nav\" list")
+		}
+	}
+	root := NewRootTocNord(docPath)
+	if e = addYamlEntries(root, entries, docPath); e != nil {
+		return nil, fmt.Errorf("ReadYamlOutline: %w", e)
+	}
+	return root, nil
+}
+
+func addYamlEntries(par Norder, entries []interface{}, docPath string) error {
+	for _, ent := range entries {
+		var title string
+		var val interface{}
+		switch v := ent.(type) {
+		case string:
+			val = v
+		case yaml.MapSlice:
+			if len(v) != 1 {
+				return fmt.Errorf("entry under <%s> has %d keys, "+
+					"not 1", par.RelFP(), len(v))
+			}
+			title = fmt.Sprint(v[0].Key)
+			val = v[0].Value
+		case map[interface{}]interface{}:
+			if len(v) != 1 {
+				return fmt.Errorf("entry under <%s> has %d keys, "+
+					"not 1", par.RelFP(), len(v))
+			}
+			for k, vv := range v {
+				title, val = fmt.Sprint(k), vv
+			}
+		default:
+			return fmt.Errorf("entry under <%s> has bad type %T",
+				par.RelFP(), ent)
+		}
+		switch v := val.(type) {
+		case string:
+			par.AddKid(NewTocNord(par, title, v, docPath))
+		case []interface{}:
+			// A bare first entry is the section's own target.
+			var href string
+			if len(v) > 0 {
+				if s, ok := v[0].(string); ok {
+					href, v = s, v[1:]
+				}
+			}
+			kid := par.AddKid(NewTocNord(par, title, href, docPath))
+			if e := addYamlEntries(kid, v, docPath); e != nil {
+				return e
+			}
+		case nil:
+			par.AddKid(NewTocNord(par, title, "", docPath))
+		default:
+			return fmt.Errorf("entry <%s> has bad value type %T",
+				title, val)
+		}
+	}
+	return nil
+}
+
+// WriteYamlOutline writes the tree under root as a YAML outline with
+// the list under the key "nav". Titles and targets are taken from kids
+// that are [*TocNord]; for any other kind of Norder, the base name of
+// its relPath is the title and (unless it is a dir) the relPath
+// is the target.
+//
+// A section's own target is written as a bare first entry in its
+// list (see the top of this file).
+// .
+func WriteYamlOutline(w io.Writer, root Norder) error {
+	doc := yaml.MapSlice{{Key: "nav", Value: yamlEntries(root, false)}}
+	bb, e := yaml.Marshal(doc)
+	if e != nil {
+		return fmt.Errorf("WriteYamlOutline: %w", e)
+	}
+	if _, e = w.Write(bb); e != nil {
+		return fmt.Errorf("WriteYamlOutline: %w", e)
+	}
+	return nil
+}
+
+// yamlEntries returns the entries for par's kids. If inSection,
+// par is written as a section, so that a bare first entry would
+// be read back as its target.
+func yamlEntries(par Norder, inSection bool) []interface{} {
+	var out = []interface{}{}
+	for kid := par.FirstKid(); kid != nil; kid = kid.NextKid() {
+		title, href := tocTitleAndHref(kid)
+		if kid.HasKids() {
+			kids := yamlEntries(kid, true)
+			if href != "" {
+				kids = append([]interface{}{href}, kids...)
+			}
+			out = append(out, yaml.MapSlice{{Key: title, Value: kids}})
+		} else if title == "" && !(inSection && len(out) == 0) {
+			out = append(out, href)
+		} else {
+			out = append(out, yaml.MapSlice{{Key: title, Value: href}})
+		}
+	}
+	return out
+}
+
+// tocTitleAndHref gets the title and the target of any Norder.
+func tocTitleAndHref(p Norder) (title, href string) {
+	if tn, ok := p.(*TocNord); ok {
+		return tn.Title, tn.Href
+	}
+	if p.IsDir() {
+		return FP.Base(p.RelFP()), ""
+	}
+	return FP.Base(p.RelFP()), FP.ToSlash(p.RelFP())
+}
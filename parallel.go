@@ -0,0 +1,272 @@
+package orderednodes
+
+// This file walks a tree with a pool of goroutines, for when the work
+// per node (like hashing or parsing a file) is much more expensive
+// than the walk itself. A Nord's kids are not queued until its own
+// callback has returned, so a callback can rely on its parent's
+// callback having completed (and on seeing anything it wrote).
+//
+// The tree must not be modified during a parallel walk.
+
+import (
+	"runtime"
+	"sync"
+)
+
+// ParallelInspect calls fn for every Nord in the tree under (and
+// including) root, using up to workers goroutines (or GOMAXPROCS,
+// if workers < 1). fn for a Nord completes before fn is called for
+// any of its kids, but otherwise the order of the calls is not
+// defined, and fn must be safe to call concurrently.
+//
+// fn's return value works as for [InspectTree]: [SkipDir] skips the
+// Nord's kids, [SkipAll] stops the walk (and is not returned), and
+// any other error stops the walk and is returned. When the walk is
+// stopped, calls that are already running are allowed to complete,
+// but no new ones are started, so which Nords were visited depends
+// on scheduling. A loop in the links stops the walk with an error
+// that wraps [ErrCycle].
+// .
+func ParallelInspect(root Norder, workers int, fn InspectorFunc) error {
+	var w = newParallelWalk(fn)
+	return w.run(root, workers)
+}
+
+// ParallelInspectOrdered is like [ParallelInspect], but fn returns a
+// result for each Nord, and the results are passed to deliver in
+// preorder (i.e. the order of [InspectTree]), as soon as each one
+// and all the ones before it are available. deliver is called in
+// the caller's goroutine, never concurrently, so it can assemble the
+// results deterministically, without any locking.
+//
+// A Nord's result is delivered if fn returned nil or [SkipDir] for
+// it (in which case the Nord's kids are skipped). If deliver returns
+// an error, the walk is stopped, and the error is returned (unless
+// it is SkipAll). If the walk is stopped (by fn or by deliver), the
+// delivery stops at the first Nord that was not visited.
+//
+// The order is computed by a (sequential, but cheap) walk of the tree
+// before the parallel walk starts.
+// .
+func ParallelInspectOrdered[T any](root Norder, workers int,
+	fn func(Norder) (T, error), deliver func(Norder, T) error) error {
+
+	// Number the Nords in preorder, and note where each subtree ends.
+	var nodes []Norder
+	var end []int
+	var idx = make(map[*Nord]int)
+	var open []int
+	e := inspectTreeIterativelyUntil(root,
+		func(n Norder) error {
+			idx[n.nord()] = len(nodes)
+			open = append(open, len(nodes))
+			nodes = append(nodes, n)
+			end = append(end, 0)
+			return nil
+		},
+		func(n Norder) error {
+			end[open[len(open)-1]] = len(nodes)
+			open = open[:len(open)-1]
+			return nil
+		}, "ParallelInspectOrdered")
+	if e != nil {
+		return e
+	}
+	var (
+		mu   sync.Mutex
+		cond = sync.NewCond(&mu)
+		res  = make([]T, len(nodes))
+		done = make([]bool, len(nodes))
+		// next is the index of the Nord to deliver after
+		// this one, which skips the subtree after SkipDir.
+		next     = make([]int, len(nodes))
+		finished bool
+		walkErr  error
+	)
+	var w = newParallelWalk(func(n Norder) error {
+		r, e := fn(n)
+		if e != nil && e != SkipDir {
+			return e
+		}
+		i := idx[n.nord()]
+		mu.Lock()
+		res[i], done[i] = r, true
+		next[i] = i + 1
+		if e == SkipDir {
+			next[i] = end[i]
+		}
+		cond.Broadcast()
+		mu.Unlock()
+		return e
+	})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		e := w.run(root, workers)
+		mu.Lock()
+		walkErr, finished = e, true
+		cond.Broadcast()
+		mu.Unlock()
+	}()
+
+	var deliverErr error
+	mu.Lock()
+	for i := 0; i < len(nodes); {
+		for !done[i] && !finished {
+			cond.Wait()
+		}
+		if !done[i] {
+			break
+		}
+		r, j := res[i], next[i]
+		var zero T
+		res[i] = zero
+		mu.Unlock()
+		deliverErr = deliver(nodes[i], r)
+		mu.Lock()
+		if deliverErr != nil {
+			break
+		}
+		i = j
+	}
+	mu.Unlock()
+	if deliverErr != nil {
+		w.stop(deliverErr)
+	}
+	wg.Wait()
+	if deliverErr != nil {
+		if deliverErr == SkipAll {
+			return nil
+		}
+		return deliverErr
+	}
+	return walkErr
+}
+
+// parallelTask is a Nord to visit.
+type parallelTask struct {
+	n     Norder
+	depth int
+}
+
+// parallelWalk is the shared state of the workers of a parallel walk.
+type parallelWalk struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// queue is used as a stack, which keeps it short
+	// (about the depth times the number of kids).
+	queue []parallelTask
+	// busy is the number of tasks being worked on,
+	// which can add more tasks to the queue.
+	busy    int
+	stopped bool
+	err     error
+	visit   InspectorFunc
+}
+
+func newParallelWalk(visit InspectorFunc) *parallelWalk {
+	w := &parallelWalk{visit: visit}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// run walks the tree from root and returns the first error,
+// except SkipAll.
+func (w *parallelWalk) run(root Norder, workers int) error {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	w.mu.Lock()
+	w.queue = append(w.queue, parallelTask{n: root})
+	w.mu.Unlock()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+	// Under the lock, because stop can still be called.
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == SkipAll {
+		return nil
+	}
+	return w.err
+}
+
+// stop stops the walk, and records e if it is the first error.
+func (w *parallelWalk) stop(e error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopLocked(e)
+}
+
+func (w *parallelWalk) stopLocked(e error) {
+	if !w.stopped {
+		w.stopped, w.err = true, e
+	}
+	w.cond.Broadcast()
+}
+
+// work is a worker's loop. It returns when the walk is stopped,
+// or when the queue is empty and no other worker can add to it.
+func (w *parallelWalk) work() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for {
+		for len(w.queue) == 0 && w.busy > 0 && !w.stopped {
+			w.cond.Wait()
+		}
+		if w.stopped || len(w.queue) == 0 {
+			w.cond.Broadcast()
+			return
+		}
+		t := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		w.busy++
+		w.mu.Unlock()
+
+		e := w.visit(t.n)
+		var kids []parallelTask
+		if e == nil {
+			kids, e = parallelKids(t)
+		}
+
+		w.mu.Lock()
+		w.busy--
+		switch e {
+		case nil:
+			// Push in reverse, so that kids are popped in order.
+			for i := len(kids) - 1; i >= 0; i-- {
+				w.queue = append(w.queue, kids[i])
+			}
+		case SkipDir:
+		default:
+			w.stopLocked(e)
+		}
+		w.cond.Broadcast()
+	}
+}
+
+// parallelKids returns the tasks for t's kids.
+func parallelKids(t parallelTask) ([]parallelTask, error) {
+	var kids []parallelTask
+	var g loopGuard
+	for k := t.n.FirstKid(); k != nil; k = k.NextKid() {
+		if g.loops(k) {
+			return nil, kidLoopError("ParallelInspect", t.n, k)
+		}
+		if kidIsAncestor(t.n, k) {
+			return nil, backLinkError("ParallelInspect", t.n, k)
+		}
+		if t.depth >= MaxTreeDepth {
+			return nil, tooDeepError("ParallelInspect", k)
+		}
+		kids = append(kids, parallelTask{n: k, depth: t.depth + 1})
+	}
+	return kids, nil
+}
@@ -0,0 +1,126 @@
+package orderednodes
+
+import (
+	"errors"
+	"fmt"
+	S "strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// parallelTestTree returns a tree of depth levels below the root, in
+// which every Nord above the bottom has fanOut kids, with relPaths
+// like "0/2/1".
+func parallelTestTree(depth, fanOut int) *Nord {
+	root := &Nord{relPath: ".", isRoot: true, isDir: true}
+	var grow func(p *Nord, level int)
+	grow = func(p *Nord, level int) {
+		if level == depth {
+			return
+		}
+		for i := 0; i < fanOut; i++ {
+			k := &Nord{relPath: kidRelPath(p, fmt.Sprint(i))}
+			p.AddKid(k)
+			grow(k, level+1)
+		}
+	}
+	grow(root, 0)
+	return root
+}
+
+func TestParallelInspect(t *testing.T) {
+	for _, workers := range []int{0, 1, 4, 32} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			root := parallelTestTree(3, 5)
+			var mu sync.Mutex
+			var done = make(map[*Nord]bool)
+			e := ParallelInspect(root, workers, func(n Norder) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if !n.IsRoot() && !done[n.Parent().nord()] {
+					t.Errorf("<%s> before its parent", n.RelFP())
+				}
+				done[n.nord()] = true
+				if n.RelFP() == "2" {
+					return SkipDir
+				}
+				return nil
+			})
+			if e != nil {
+				t.Fatal(e)
+			}
+			// All but the 5+25 Nords under "2".
+			if want := 1 + 5 + 25 + 125 - 30; len(done) != want {
+				t.Errorf("visited %d Nords, want %d", len(done), want)
+			}
+		})
+	}
+}
+
+func TestParallelInspectOrdered(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name string
+		// fnRet and deliverRet are what fn and deliver
+		// return for the Nord with that relPath.
+		fnRet      map[string]error
+		deliverRet map[string]error
+		// want is the delivered relPaths, or if it ends in
+		// "...", what they start with: the walk is stopped,
+		// so the rest is some prefix of the preorder that
+		// depends on scheduling.
+		want    string
+		wantErr error
+	}{
+		{"all", nil, nil, ". 0 0/0 0/1 0/2 1 1/0 1/1 1/2 2 2/0 2/1 2/2", nil},
+		{"SkipDir", map[string]error{"1": SkipDir}, nil,
+			". 0 0/0 0/1 0/2 1 2 2/0 2/1 2/2", nil},
+		{"SkipDir on the root", map[string]error{".": SkipDir}, nil,
+			".", nil},
+		{"SkipAll in deliver", nil, map[string]error{"0/1": SkipAll},
+			". 0 0/0 0/1", nil},
+		{"error in deliver", nil, map[string]error{"1": errStop},
+			". 0 0/0 0/1 0/2 1", errStop},
+		{"SkipAll in fn", map[string]error{"1": SkipAll}, nil,
+			". ...", nil},
+		{"error in fn", map[string]error{"1/0": errStop}, nil,
+			". ...", errStop},
+	}
+	var all = tests[0].want
+	for _, tc := range tests {
+		for _, workers := range []int{1, 4} {
+			t.Run(fmt.Sprint(tc.name, "/", workers), func(t *testing.T) {
+				var got []string
+				e := ParallelInspectOrdered(parallelTestTree(2, 3), workers,
+					func(n Norder) (string, error) {
+						// Finish later Nords first, to scramble the order.
+						if n.RelFP() == "0" {
+							time.Sleep(5 * time.Millisecond)
+						}
+						return n.RelFP(), tc.fnRet[n.RelFP()]
+					},
+					func(n Norder, s string) error {
+						if s != n.RelFP() {
+							t.Errorf("result %q for <%s>", s, n.RelFP())
+						}
+						got = append(got, s)
+						return tc.deliverRet[s]
+					})
+				if want, ok := S.CutSuffix(tc.want, " ..."); ok {
+					g := S.Join(got, " ")
+					if !S.HasPrefix(g+" ", want+" ") ||
+						!S.HasPrefix(all+" ", g+" ") {
+						t.Errorf("got %v, want a prefix of %s "+
+							"that starts with %s", got, all, want)
+					}
+				} else if S.Join(got, " ") != tc.want {
+					t.Errorf("got %v, want %s", got, tc.want)
+				}
+				if !errors.Is(e, tc.wantErr) || (e == nil) != (tc.wantErr == nil) {
+					t.Errorf("got error %v, want %v", e, tc.wantErr)
+				}
+			})
+		}
+	}
+}
@@ -29,6 +29,10 @@ func (p Nord) LinePrefixString() string {
 	} else {
 		// (spaces)[lvl:seq]"
 		// func S.Repeat(s string, count int) string
+		if p.seqID != 0 {
+			return fmt.Sprintf("%s[%02d:%02d]",
+				S.Repeat("  ", p.level-1), p.level, p.seqID)
+		}
 		return fmt.Sprintf("%s[%02d]", // "%s[%02d:%02d]", 
 			S.Repeat("  ", p.level-1), p.level) // ,p.seqID)
 	}
@@ -0,0 +1,490 @@
+package orderednodes
+
+// A snapshot is a compact binary encoding of a whole Nord tree, meant
+// for caching an imported tree to disk and reloading it quickly. It is
+// much faster than JSON for big trees, because there is no reflection,
+// path segments are stored only once (in a string table), and each
+// Nord's paths are normally re-derived from its parent's.
+//
+// Layout (all integers are uvarints unless noted otherwise):
+//   - magic "NORDSNAP" (8 bytes)
+//   - version (uint16, big-endian)
+//   - string table: count, then per string: length, bytes
+//   - node count
+//   - node records, in depth-first preorder, starting with the root:
+//     - string index of the Nord's path segment (its FP.Base)
+//     - flags (one byte, see snapFlag*)
+//     - if snapFlagPaths: string indices of relPath and absPath
+//     - if snapFlagLink: string index of the symlink's target
+//     - kid count
+//     - if snapFlagPayload: payload length, payload bytes
+//   - checksum: CRC-32C (Castagnoli) of all preceding bytes
+//     (uint32, big-endian)
+//
+// The root record always has snapFlagPaths set. Any other Nord sets it
+// only if its paths cannot be derived from its parent's paths plus its
+// own segment, which is typically the case for markup and ToC trees.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	FP "path/filepath"
+
+	FU "github.com/fbaube/fileutils"
+)
+
+// SnapshotVersion is the format version written by [WriteSnapshot].
+// Version 2 added symlinks (snapFlagLink and snapFlagLinkToDir).
+// [ReadSnapshot] also reads version 1.
+const SnapshotVersion = 2
+
+const snapMagic = "NORDSNAP"
+
+const (
+	snapFlagDir byte = 1 << iota
+	snapFlagRoot
+	snapFlagPaths
+	snapFlagPayload
+	snapFlagLink
+	snapFlagLinkToDir
+)
+
+// Sanity limits, on top of allocating only as much as is actually
+// read, so that a corrupt snapshot cannot make us allocate absurd
+// amounts of memory before the checksum fails.
+const (
+	maxSnapString  = 1 << 20
+	maxSnapCount   = 1 << 32
+	maxSnapPayload = 1 << 30
+)
+
+// ErrBadSnapshot is wrapped by every error that [ReadSnapshot]
+// returns for input that is not a valid snapshot.
+var ErrBadSnapshot = errors.New("bad Nord snapshot")
+
+var snapCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SnapshotPayloadFunc returns the optional payload blob to store with
+// a Nord in a snapshot. It can return nil for "no payload".
+type SnapshotPayloadFunc func(Norder) ([]byte, error)
+
+// SnapshotLoadFunc receives a Nord's payload blob (if it has one)
+// when the Nord is recreated by [ReadSnapshot].
+type SnapshotLoadFunc func(*Nord, []byte) error
+
+// WriteSnapshot writes the tree under (and including) root to w.
+// If fn is non-nil, it is called for every Nord to get a payload,
+// and each payload is written as soon as it is returned, so the
+// payloads are not all held in memory at once. Writing is not
+// recursive, so tree depth is not a problem.
+// .
+func WriteSnapshot(w io.Writer, root Norder, fn SnapshotPayloadFunc) error {
+	if root == nil {
+		return errors.New("WriteSnapshot: nil root")
+	}
+	// PASS 1: Collect records in preorder and build the string
+	// table, which has to be written before the records.
+	var strs []string
+	var strIdx = make(map[string]uint64)
+	intern := func(s string) uint64 {
+		if i, ok := strIdx[s]; ok {
+			return i
+		}
+		i := uint64(len(strs))
+		strIdx[s] = i
+		strs = append(strs, s)
+		return i
+	}
+	type rec struct {
+		seg, rel, abs uint64
+		link          uint64
+		flags         byte
+		nKids         uint64
+	}
+	var recs []rec
+	var rootAbs = root.AbsFP()
+	snapWalk(root, func(n, par Norder, nKids int) {
+		var r rec
+		r.seg = intern(snapSegment(n.RelFP()))
+		if n.IsDir() {
+			r.flags |= snapFlagDir
+		}
+		if par == nil {
+			r.flags |= snapFlagRoot | snapFlagPaths
+		} else {
+			rel, abs := snapDerivePaths(par, rootAbs,
+				snapSegment(n.RelFP()), n.IsDir())
+			if rel != n.RelFP() || abs != n.AbsFP() {
+				r.flags |= snapFlagPaths
+			}
+		}
+		if r.flags&snapFlagPaths != 0 {
+			r.rel = intern(n.RelFP())
+			r.abs = intern(n.AbsFP())
+		}
+		if t := n.LinkTarget(); t != "" {
+			r.flags |= snapFlagLink
+			r.link = intern(t)
+			if n.IsDirlike() && !n.IsDir() {
+				r.flags |= snapFlagLinkToDir
+			}
+		}
+		r.nKids = uint64(nKids)
+		recs = append(recs, r)
+	})
+	// PASS 2: Write it all out, getting the
+	// payloads by walking the tree again.
+	var crc = crc32.New(snapCRCTable)
+	var bw = bufio.NewWriter(io.MultiWriter(w, crc))
+	var buf [binary.MaxVarintLen64]byte
+	putU := func(u uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf[:], u)])
+	}
+	bw.WriteString(snapMagic)
+	binary.BigEndian.PutUint16(buf[:2], SnapshotVersion)
+	bw.Write(buf[:2])
+	putU(uint64(len(strs)))
+	for _, s := range strs {
+		putU(uint64(len(s)))
+		bw.WriteString(s)
+	}
+	putU(uint64(len(recs)))
+	var i int
+	var plErr error
+	errChanged := errors.New("WriteSnapshot: tree changed while writing")
+	snapWalk(root, func(n, _ Norder, nKids int) {
+		if plErr != nil {
+			return
+		}
+		if i == len(recs) || recs[i].nKids != uint64(nKids) {
+			plErr = errChanged
+			return
+		}
+		r := recs[i]
+		i++
+		var pl []byte
+		if fn != nil {
+			var e error
+			if pl, e = fn(n); e != nil {
+				plErr = fmt.Errorf("WriteSnapshot: payload for <%s>: %w",
+					n.RelFP(), e)
+				return
+			}
+			if pl != nil {
+				r.flags |= snapFlagPayload
+			}
+		}
+		putU(r.seg)
+		bw.WriteByte(r.flags)
+		if r.flags&snapFlagPaths != 0 {
+			putU(r.rel)
+			putU(r.abs)
+		}
+		if r.flags&snapFlagLink != 0 {
+			putU(r.link)
+		}
+		putU(r.nKids)
+		if r.flags&snapFlagPayload != 0 {
+			putU(uint64(len(pl)))
+			bw.Write(pl)
+		}
+	})
+	if plErr == nil && i != len(recs) {
+		plErr = errChanged
+	}
+	if plErr != nil {
+		return plErr
+	}
+	if e := bw.Flush(); e != nil {
+		return fmt.Errorf("WriteSnapshot: %w", e)
+	}
+	binary.BigEndian.PutUint32(buf[:4], crc.Sum32())
+	if _, e := w.Write(buf[:4]); e != nil {
+		return fmt.Errorf("WriteSnapshot: %w", e)
+	}
+	return nil
+}
+
+// snapWalk calls f for each Nord under (and including) root in
+// preorder, with its parent (nil for root) and its number of kids.
+// It is not recursive.
+func snapWalk(root Norder, f func(n, par Norder, nKids int)) {
+	var stack = []Norder{root}
+	var parStack = []Norder{nil}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		par := parStack[len(parStack)-1]
+		stack = stack[:len(stack)-1]
+		parStack = parStack[:len(parStack)-1]
+		// Push kids in reverse, so that they pop in order.
+		var kids []Norder
+		for k := n.FirstKid(); k != nil; k = k.NextKid() {
+			kids = append(kids, k)
+		}
+		f(n, par, len(kids))
+		for i := len(kids) - 1; i >= 0; i-- {
+			stack = append(stack, kids[i])
+			parStack = append(parStack, n)
+		}
+	}
+}
+
+// ReadSnapshot recreates a tree of [*Nord] from a snapshot written by
+// [WriteSnapshot], and returns its root. If fn is non-nil, it is called
+// for every Nord that has a payload (in preorder). The checksum is
+// verified before fn is called and the tree is returned, so the
+// payloads are held in memory until then.
+// .
+func ReadSnapshot(r io.Reader, fn SnapshotLoadFunc) (*Nord, error) {
+	var sr = &snapReader{br: bufio.NewReader(r), crc: crc32.New(snapCRCTable)}
+	var magic [len(snapMagic)]byte
+	sr.full(magic[:])
+	if sr.err == nil && string(magic[:]) != snapMagic {
+		return nil, fmt.Errorf("ReadSnapshot: %w: no magic", ErrBadSnapshot)
+	}
+	var vbuf [2]byte
+	sr.full(vbuf[:])
+	if v := binary.BigEndian.Uint16(vbuf[:]); sr.err == nil &&
+		(v < 1 || v > SnapshotVersion) {
+		return nil, fmt.Errorf("ReadSnapshot: %w: version %d not supported",
+			ErrBadSnapshot, binary.BigEndian.Uint16(vbuf[:]))
+	}
+	// The string table
+	nStrs := sr.count(maxSnapCount)
+	var strs []string
+	for i := uint64(0); i < nStrs && sr.err == nil; i++ {
+		strs = append(strs, string(sr.bytes(maxSnapString)))
+	}
+	str := func(i uint64) string {
+		if i >= uint64(len(strs)) {
+			sr.fail("string index out of range")
+			return ""
+		}
+		return strs[i]
+	}
+	// The Nords
+	type pending struct {
+		nord  *Nord
+		nKids uint64
+	}
+	type payload struct {
+		nord *Nord
+		pl   []byte
+	}
+	var root *Nord
+	var stack []pending
+	var payloads []payload
+	nNords := sr.count(maxSnapCount)
+	for i := uint64(0); i < nNords && sr.err == nil; i++ {
+		seg := str(sr.u())
+		flags := sr.flags()
+		p := new(Nord)
+		p.lineSummaryFunc = NordEng.summaryString
+		p.isDir = flags&snapFlagDir != 0
+		p.isRoot = flags&snapFlagRoot != 0
+		if flags&snapFlagPaths != 0 {
+			p.relPath = str(sr.u())
+			p.absPath = FU.AbsFilePath(str(sr.u()))
+		}
+		if flags&snapFlagLink != 0 {
+			p.linkTarget = str(sr.u())
+			p.linkToDir = flags&snapFlagLinkToDir != 0
+		}
+		nKids := sr.u()
+		var pl []byte
+		if flags&snapFlagPayload != 0 {
+			pl = sr.bytes(maxSnapPayload)
+		}
+		if sr.err != nil {
+			break
+		}
+		if root == nil {
+			if !p.isRoot {
+				sr.fail("first record is not a root")
+				break
+			}
+			root = p
+		} else {
+			if p.isRoot {
+				sr.fail("second root record")
+				break
+			}
+			// Pop the parents that have all their kids.
+			for len(stack) > 0 && stack[len(stack)-1].nKids == 0 {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				sr.fail("more records than kid counts")
+				break
+			}
+			par := &stack[len(stack)-1]
+			par.nKids--
+			if flags&snapFlagPaths == 0 {
+				rel, abs := snapDerivePaths(par.nord,
+					root.AbsFP(), seg, p.isDir)
+				p.relPath = rel
+				p.absPath = FU.AbsFilePath(abs)
+			}
+			par.nord.AddKid(p)
+		}
+		if pl != nil && fn != nil {
+			payloads = append(payloads, payload{p, pl})
+		}
+		stack = append(stack, pending{p, nKids})
+	}
+	if sr.err == nil {
+		for _, pp := range stack {
+			if pp.nKids != 0 {
+				sr.fail("fewer records than kid counts")
+				break
+			}
+		}
+	}
+	if sr.err == nil && root == nil {
+		sr.fail("no root")
+	}
+	if sr.err != nil {
+		return nil, fmt.Errorf("ReadSnapshot: %w", sr.err)
+	}
+	// Checksum, which is not itself checksummed
+	want := sr.crc.Sum32()
+	var cbuf [4]byte
+	if _, e := io.ReadFull(sr.br, cbuf[:]); e != nil {
+		return nil, fmt.Errorf("ReadSnapshot: %w: missing checksum",
+			ErrBadSnapshot)
+	}
+	if got := binary.BigEndian.Uint32(cbuf[:]); got != want {
+		return nil, fmt.Errorf("ReadSnapshot: %w: checksum "+
+			"is %08x, expected %08x", ErrBadSnapshot, got, want)
+	}
+	// Only now that the checksum is OK are the payloads passed on.
+	for _, pp := range payloads {
+		if e := fn(pp.nord, pp.pl); e != nil {
+			return nil, fmt.Errorf("ReadSnapshot: "+
+				"payload for <%s>: %w", pp.nord.relPath, e)
+		}
+	}
+	return root, nil
+}
+
+// snapSegment is the last element of a relPath.
+func snapSegment(relPath string) string {
+	return FP.Base(FU.StripTrailingPathSep(relPath))
+}
+
+// snapDerivePaths returns the paths that [NewNord] would give a Nord
+// named seg whose parent is par, in the tree rooted at rootAbs.
+func snapDerivePaths(par Norder, rootAbs, seg string, isDir bool) (rel, abs string) {
+	if par.IsRoot() {
+		rel = seg
+	} else {
+		rel = FP.Join(par.RelFP(), seg)
+	}
+	abs = FP.Join(rootAbs, rel)
+	if isDir {
+		abs = FU.EnsureTrailingPathSep(abs)
+	}
+	return rel, abs
+}
+
+// snapReader checksums exactly the bytes that it consumes,
+// and remembers its first error so that callers can check
+// only once in a while.
+type snapReader struct {
+	br  *bufio.Reader
+	crc hash.Hash32
+	err error
+}
+
+func (sr *snapReader) fail(msg string) {
+	if sr.err == nil {
+		sr.err = fmt.Errorf("%w: %s", ErrBadSnapshot, msg)
+	}
+}
+
+func (sr *snapReader) setErr(e error) {
+	if sr.err != nil {
+		return
+	}
+	if e == io.EOF || e == io.ErrUnexpectedEOF {
+		sr.fail("truncated")
+		return
+	}
+	sr.err = e
+}
+
+// ReadByte implements [io.ByteReader] for [binary.ReadUvarint].
+func (sr *snapReader) ReadByte() (byte, error) {
+	b, e := sr.br.ReadByte()
+	if e == nil {
+		sr.crc.Write([]byte{b})
+	}
+	return b, e
+}
+
+func (sr *snapReader) flags() byte {
+	if sr.err != nil {
+		return 0
+	}
+	b, e := sr.ReadByte()
+	sr.setErr(e)
+	return b
+}
+
+func (sr *snapReader) u() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	u, e := binary.ReadUvarint(sr)
+	sr.setErr(e)
+	return u
+}
+
+// count reads a uvarint that is a length and checks it against max.
+func (sr *snapReader) count(max uint64) uint64 {
+	u := sr.u()
+	if u > max {
+		sr.fail(fmt.Sprintf("length %d exceeds %d", u, max))
+		return 0
+	}
+	return u
+}
+
+// bytes reads a length (checked against max) and then that many
+// bytes. The buffer grows as the bytes arrive, so a corrupt length
+// cannot make it allocate more than the input actually has.
+func (sr *snapReader) bytes(max uint64) []byte {
+	n := sr.count(max)
+	if sr.err != nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	got, e := io.CopyN(&buf, sr.br, int64(n))
+	if got < int64(n) && e == nil {
+		e = io.ErrUnexpectedEOF
+	}
+	sr.setErr(e)
+	if e != nil {
+		return nil
+	}
+	sr.crc.Write(buf.Bytes())
+	// Not nil, even if empty, because a nil payload means none.
+	return append([]byte{}, buf.Bytes()...)
+}
+
+func (sr *snapReader) full(bb []byte) {
+	if sr.err != nil {
+		return
+	}
+	_, e := io.ReadFull(sr.br, bb)
+	sr.setErr(e)
+	if e == nil {
+		sr.crc.Write(bb)
+	}
+}
@@ -0,0 +1,168 @@
+package orderednodes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// snapTestTree returns a small tree with a dir, a file, a symlink to
+// the dir, and a Nord whose paths cannot be derived from its parent's.
+func snapTestTree() *Nord {
+	r := &Nord{relPath: ".", absPath: "/r/", isRoot: true, isDir: true}
+	a := &Nord{relPath: "a", absPath: "/r/a/", isDir: true}
+	x := &Nord{relPath: "a/x.txt", absPath: "/r/a/x.txt"}
+	l := &Nord{relPath: "l", absPath: "/r/l", linkTarget: "a", linkToDir: true}
+	w := &Nord{relPath: "w", absPath: "/elsewhere/w"}
+	r.AddKid(a)
+	a.AddKid(x)
+	r.AddKid(l)
+	r.AddKid(w)
+	return r
+}
+
+// snapPreorder returns the Nords under (and including) p, in preorder.
+func snapPreorder(p Norder) []Norder {
+	var nn []Norder
+	InspectTree(p, func(n Norder) error {
+		nn = append(nn, n)
+		return nil
+	})
+	return nn
+}
+
+// snapWithCRC returns bb followed by its checksum.
+func snapWithCRC(bb []byte) []byte {
+	return binary.BigEndian.AppendUint32(bb,
+		crc32.Checksum(bb, snapCRCTable))
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	r := snapTestTree()
+	var buf bytes.Buffer
+	e := WriteSnapshot(&buf, r, func(n Norder) ([]byte, error) {
+		if n.RelFP() == "a/x.txt" {
+			return []byte("PAY"), nil
+		}
+		return nil, nil
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	var got []string
+	r2, e := ReadSnapshot(&buf, func(n *Nord, pl []byte) error {
+		got = append(got, n.RelFP()+":"+string(pl))
+		return nil
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(got) != 1 || got[0] != "a/x.txt:PAY" {
+		t.Errorf("payloads: got %q", got)
+	}
+	want, have := snapPreorder(r), snapPreorder(r2)
+	if len(want) != len(have) {
+		t.Fatalf("got %d Nords, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if want[i].RelFP() != have[i].RelFP() ||
+			want[i].AbsFP() != have[i].AbsFP() ||
+			want[i].IsDir() != have[i].IsDir() ||
+			want[i].IsDirlike() != have[i].IsDirlike() ||
+			want[i].LinkTarget() != have[i].LinkTarget() {
+			t.Errorf("Nord %d: got <%s|%s>, want <%s|%s>", i,
+				have[i].RelFP(), have[i].AbsFP(),
+				want[i].RelFP(), want[i].AbsFP())
+		}
+	}
+}
+
+func TestSnapshotVersion1(t *testing.T) {
+	// A version 1 snapshot is the same, minus symlinks.
+	r := snapTestTree()
+	r.FirstKid().NextKid().nord().linkTarget = ""
+	var buf bytes.Buffer
+	if e := WriteSnapshot(&buf, r, nil); e != nil {
+		t.Fatal(e)
+	}
+	bb := buf.Bytes()
+	bb[len(snapMagic)+1] = 1
+	bb = snapWithCRC(bb[:len(bb)-4])
+	if _, e := ReadSnapshot(bytes.NewReader(bb), nil); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	e := WriteSnapshot(&buf, snapTestTree(), func(Norder) ([]byte, error) {
+		return []byte("pl"), nil
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	good := buf.Bytes()
+	header := append([]byte(snapMagic), 0, SnapshotVersion)
+	tests := []struct {
+		name string
+		bb   []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte("NORDSNAX"), good[8:]...)},
+		{"bad version", append(append([]byte(snapMagic), 0, 99), good[10:]...)},
+		{"truncated", good[:len(good)/2]},
+		{"no checksum", good[:len(good)-4]},
+		{"flipped byte", func() []byte {
+			bb := bytes.Clone(good)
+			bb[len(bb)/2] ^= 0xff
+			return bb
+		}()},
+		// A string that claims to be 1 MiB, in a tiny input.
+		{"huge string", snapWithCRC(append(bytes.Clone(header),
+			1, 0x80, 0x80, 0x40, 'x'))},
+		// One Nord, whose payload claims to be 1 GiB.
+		{"huge payload", snapWithCRC(append(bytes.Clone(header),
+			1, 1, 'r', 1, 0, snapFlagRoot|snapFlagPaths|snapFlagPayload,
+			0, 0, 0, 0x80, 0x80, 0x80, 0x80, 0x04, 'x'))},
+		{"string index", snapWithCRC(append(bytes.Clone(header),
+			0, 1, 7, snapFlagRoot|snapFlagPaths, 0, 0, 0))},
+		{"first is not root", snapWithCRC(append(bytes.Clone(header),
+			1, 1, 'r', 1, 0, 0, 0))},
+		{"too few records", snapWithCRC(append(bytes.Clone(header),
+			1, 1, 'r', 1, 0, snapFlagRoot|snapFlagPaths, 0, 0, 2))},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var called bool
+			_, e := ReadSnapshot(bytes.NewReader(tc.bb),
+				func(*Nord, []byte) error {
+					called = true
+					return nil
+				})
+			if !errors.Is(e, ErrBadSnapshot) {
+				t.Errorf("got %v, want %v", e, ErrBadSnapshot)
+			}
+			if called {
+				t.Error("payload func called for a bad snapshot")
+			}
+		})
+	}
+}
+
+func TestSnapshotTreeChanged(t *testing.T) {
+	r := snapTestTree()
+	// The payload func changes the tree during the second walk,
+	// by giving a kid to a Nord that has not been written yet.
+	var buf bytes.Buffer
+	e := WriteSnapshot(&buf, r, func(n Norder) ([]byte, error) {
+		if n.RelFP() == "a" {
+			r.LastKid().AddKid(&Nord{relPath: "w/z", absPath: "/r/w/z"})
+		}
+		return nil, nil
+	})
+	if e == nil {
+		t.Error("no error for a tree that changed while writing")
+	}
+}
@@ -0,0 +1,139 @@
+package orderednodes
+
+// This file summarizes a tree: its shape, and (for a tree of files)
+// its sizes, plus a general way to roll values up a tree, bottom-up.
+
+import (
+	"fmt"
+	"os"
+	FP "path/filepath"
+)
+
+// TreeStats describes a tree (or subtree); see [Stats].
+type TreeStats struct {
+	// Nodes is the number of Nords, and Leaves
+	// is the number of them that have no kids.
+	Nodes, Leaves int
+	// MaxDepth is the number of levels below the
+	// top (so it is 0 for a tree of just one Nord).
+	MaxDepth int
+	// MaxFanOut is the most kids that any Nord has.
+	MaxFanOut int
+	// PerLevel is the number of Nords at each level,
+	// starting with the top (so PerLevel[0] is 1).
+	PerLevel []int
+	// Files is the number of Nords that are files (i.e. that
+	// are not dirs, and have file info; see [Stats]), Bytes is
+	// their total size, and ByExt counts them by extension (as
+	// per [filepath.Ext], so for example ".dita", or "" if they
+	// have none).
+	Files int
+	Bytes int64
+	ByExt map[string]int
+}
+
+// String is a one-line summary.
+func (ts TreeStats) String() string {
+	return fmt.Sprintf("%d nodes (%d leaves), depth %d, max fan-out %d, "+
+		"%d files (%d bytes)", ts.Nodes, ts.Leaves, ts.MaxDepth,
+		ts.MaxFanOut, ts.Files, ts.Bytes)
+}
+
+// Stats returns the TreeStats of the tree under (and including) p.
+//
+// A Nord that is not a dir is counted as a file if it carries file
+// info (as a [FilePropsNord] does; see [NordDirEntry]), or else if
+// its AbsFP is its own file (i.e. its name is that of the file) and
+// [os.Lstat] of it succeeds. So a Nord whose AbsFP is the document
+// that it is in (like a topichead in a map, or a section of Markdown)
+// is not counted. A symlink's size is that of the link itself.
+// .
+func Stats(p Norder) (TreeStats, error) {
+	var ts = TreeStats{ByExt: make(map[string]int)}
+	// depth is that of the Nords being visited, counted
+	// by the walk itself (rather than trusting Level).
+	var depth int
+	e := inspectTreeIteratively(p, func(n Norder) error {
+		ts.Nodes++
+		d := depth
+		depth++
+		if d >= len(ts.PerLevel) {
+			ts.PerLevel = append(ts.PerLevel, 0)
+		}
+		ts.PerLevel[d]++
+		ts.MaxDepth = max(ts.MaxDepth, d)
+		kc := n.KidCount()
+		ts.MaxFanOut = max(ts.MaxFanOut, kc)
+		if kc == 0 {
+			ts.Leaves++
+		}
+		if n.IsDir() {
+			return nil
+		}
+		fi := nordFileInfo(n)
+		if fi == nil {
+			if FP.Base(n.AbsFP()) != kidName(n) {
+				return nil
+			}
+			var e error
+			if fi, e = os.Lstat(n.AbsFP()); e != nil {
+				return nil
+			}
+		}
+		ts.Files++
+		ts.Bytes += fi.Size()
+		ts.ByExt[FP.Ext(kidName(n))]++
+		return nil
+	}, func(n Norder) error {
+		depth--
+		return nil
+	}, "Stats")
+	if e != nil {
+		return ts, fmt.Errorf("Stats: %w", e)
+	}
+	return ts, nil
+}
+
+// Aggregate computes a value for every Nord in the tree under (and
+// including) p, bottom-up, and returns the value for p. The value for
+// a Nord that has no kids is computed by leafFn, and the value for
+// any other Nord is computed by combineFn from the values of its kids
+// (in order). For example, for disk usage, leafFn returns the size
+// of a file, and combineFn returns the sum of the kids' values.
+//
+// An error from either func stops it, and is returned. It does not
+// recurse, so it works for trees of any depth (up to [MaxTreeDepth]).
+// .
+func Aggregate[T any](p Norder, leafFn func(Norder) (T, error),
+	combineFn func(n Norder, kids []T) (T, error)) (T, error) {
+
+	// stack has the values of the kids of each open Nord,
+	// plus (at the bottom) a slot for the value of p.
+	var stack = [][]T{nil}
+	e := inspectTreeIteratively(p,
+		func(n Norder) error {
+			stack = append(stack, nil)
+			return nil
+		},
+		func(n Norder) error {
+			kids := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			var v T
+			var e error
+			if len(kids) == 0 && !n.HasKids() {
+				v, e = leafFn(n)
+			} else {
+				v, e = combineFn(n, kids)
+			}
+			if e != nil {
+				return e
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], v)
+			return nil
+		}, "Aggregate")
+	if e != nil {
+		var zero T
+		return zero, fmt.Errorf("Aggregate: %w", e)
+	}
+	return stack[0][0], nil
+}
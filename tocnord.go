@@ -0,0 +1,159 @@
+package orderednodes
+
+import (
+	"encoding/xml"
+	FP "path/filepath"
+	S "strings"
+
+	FU "github.com/fbaube/fileutils"
+)
+
+// TocNord is a Nord for one entry in a ToC (table of contents), such
+// as a navigation outline or a map file. This is the use case for which
+// Nords should be ideal: ToC entries are strictly ordered, and (unlike
+// files & dirs) any entry can have both a target and kids.
+//
+// The relPath of a TocNord is a materialized path of entry labels (see
+// [TocLabel]), so that it follows the same rules as for files & dirs.
+// The absPath is the entry's target resolved w.r.t. the directory of
+// the ToC document, or (if the target is not a local file) the path
+// of the ToC document itself.
+// .
+type TocNord struct {
+	Nord
+	// Title is the entry's human-readable label (e.g. a navtitle).
+	Title string
+	// Href is the entry's target as it was written in the source.
+	// It can be a relative path, an absolute URL, or empty.
+	Href string
+	// Tag is the name of the source element (e.g. "topicref"),
+	// for ToC formats that have elements, like DITA maps.
+	Tag string
+	// Attrs are the source element's other attributes, in order,
+	// not including any that are stored in Title or Href.
+	Attrs []xml.Attr
+	// Meta is the source element's metadata element (like a DITA
+	// <topicmeta>), as raw XML, or "". If it has a title (like a
+	// <navtitle>), that is also in Title, but Meta is what is
+	// written back.
+	Meta string
+	// Rest are the source element's other elements that are not
+	// entries (like a DITA <reltable>), as raw XML, in order.
+	Rest []string
+	// Expanded is set when the kids were not in the source
+	// document, but were read from the document at Href (as
+	// for a DITA mapref), so they should not be written back.
+	Expanded bool
+	// fromURL is set when Href was read from the url (not the
+	// pageRef) of a Hugo menu entry, so it is written back as a url.
+	fromURL bool
+}
+
+// Attr returns the value of the named attribute, or "".
+func (p *TocNord) Attr(name string) string {
+	for _, a := range p.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// NewRootTocNord returns the root of a ToC tree read from (or
+// to be written to) the document at docPath.
+func NewRootTocNord(docPath string) *TocNord {
+	p := new(TocNord)
+	p.relPath = docPath
+	p.absPath = FU.AbsFP(FP.Clean(docPath))
+	p.isRoot = true
+	p.lineSummaryFunc = NordEng.summaryString
+	return p
+}
+
+// NewTocNord returns a ToC entry with the given title and target, with
+// its paths set as if it were the next kid of parent, but not yet added
+// to parent. docPath is the path of the ToC document; if the target is
+// a relative local path, it is resolved w.r.t. the document's directory.
+// .
+func NewTocNord(parent Norder, title, href, docPath string) *TocNord {
+	p := new(TocNord)
+	p.Title = title
+	p.Href = href
+	p.relPath = kidRelPath(parent, TocLabel(title, href))
+	if fp, ok := tocLocalPath(href); ok {
+		p.absPath = FU.AbsFP(FP.Join(FP.Dir(docPath), fp))
+	} else {
+		p.absPath = FU.AbsFP(FP.Clean(docPath))
+	}
+	p.lineSummaryFunc = NordEng.summaryString
+	return p
+}
+
+// AddKid is [Nord.AddKid], except that the kid's parent
+// link is to p, so that its Parent is a *TocNord.
+func (p *TocNord) AddKid(k Norder) Norder {
+	return linkKid(p, k)
+}
+
+// AddKids is [Nord.AddKids], but using [TocNord.AddKid].
+func (p *TocNord) AddKids(kk []Norder) Norder {
+	linkKids(p, kk)
+	return p
+}
+
+// LineSummaryString shows the title and the target.
+func (p *TocNord) LineSummaryString() string {
+	if p.IsRoot() {
+		return "ROOT " + p.relPath
+	}
+	if p.Href == "" {
+		return p.Title
+	}
+	return p.Title + " -> " + p.Href
+}
+
+// TocLabel returns the path element that names a ToC entry in a
+// materialized path: the base name of its (local) target if it has
+// one, else its title. Path separators are replaced by "_".
+// .
+func TocLabel(title, href string) string {
+	var s string
+	if fp, ok := tocLocalPath(href); ok && fp != "" {
+		s = FP.Base(fp)
+	} else {
+		s = S.TrimSpace(title)
+	}
+	if s == "" || s == "." || s == ".." {
+		s = "_"
+	}
+	return S.Map(func(r rune) rune {
+		if r == '/' || r == Sep {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// kidRelPath is the relPath that a kid named label gets under parent.
+// Kids of a root get a single-element path, because a root's own
+// relPath is special (it is the path to the dir or the document).
+func kidRelPath(parent Norder, label string) string {
+	if parent == nil || parent.IsRoot() {
+		return label
+	}
+	return FP.Join(FU.StripTrailingPathSep(parent.RelFP()), label)
+}
+
+// tocLocalPath strips any fragment ("#id") or query from href, and
+// reports whether what remains is a relative path to a local file
+// (i.e. it is not empty, not a URL, and not site-absolute).
+func tocLocalPath(href string) (string, bool) {
+	if i := S.IndexAny(href, "#?"); i >= 0 {
+		href = href[:i]
+	}
+	if href == "" || S.Contains(href, "://") ||
+		S.HasPrefix(href, "/") || S.HasPrefix(href, "mailto:") {
+		return href, false
+	}
+	return FP.FromSlash(href), true
+}
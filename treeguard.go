@@ -0,0 +1,127 @@
+package orderednodes
+
+// This file has guards against damaged trees, so that traversals
+// return an error rather than spinning forever (or panicking) when
+// links form a cycle, or when a tree has no root.
+//
+// Cycles are detected using Brent's algorithm, which needs no memory
+// allocation, so the guards are cheap enough to use on every walk.
+// Downward, a loop in a kid list is detected directly, and so is a
+// kid link back to an ancestor (see [kidIsAncestor]); any other bad
+// link that makes a walk go on down makes it exceed [MaxTreeDepth].
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxTreeDepth limits how many levels a traversal will go,
+// either up or down, before it returns [ErrTooDeep].
+var MaxTreeDepth = 1 << 20
+
+var (
+	// ErrCycle is returned (wrapped) when Nord links form a cycle.
+	ErrCycle = errors.New("cycle in Nord links")
+	// ErrTooDeep is returned (wrapped) when a traversal
+	// goes more than [MaxTreeDepth] levels.
+	ErrTooDeep = errors.New("Nord tree exceeds MaxTreeDepth")
+	// ErrNoRoot is returned (wrapped) when following parent links
+	// reaches a Nord that has no parent but is not marked as a root.
+	ErrNoRoot = errors.New("Nord has no root")
+)
+
+// RootOf walks upward from p until [Norder.IsRoot] is true, and
+// returns the root. Unlike a naive walk, it returns an error if it
+// finds a cycle, runs out of parents, or exceeds [MaxTreeDepth].
+// .
+func RootOf(p Norder) (RootNorder, error) {
+	if p == nil {
+		return nil, fmt.Errorf("RootOf: nil Norder: %w", ErrNoRoot)
+	}
+	var g loopGuard
+	var n = p
+	for depth := 0; !n.IsRoot(); depth++ {
+		par := n.Parent()
+		if par == nil {
+			return nil, fmt.Errorf("RootOf <%s>: <%s> is not a "+
+				"root but has no parent: %w", p.RelFP(),
+				n.RelFP(), ErrNoRoot)
+		}
+		if depth >= MaxTreeDepth {
+			return nil, fmt.Errorf("RootOf <%s>: %w", p.RelFP(), ErrTooDeep)
+		}
+		if g.loops(par) {
+			return nil, fmt.Errorf("RootOf <%s>: parent links "+
+				"loop at <%s>: %w", p.RelFP(), par.RelFP(), ErrCycle)
+		}
+		n = par
+	}
+	return n, nil
+}
+
+// loopGuard detects a cycle in a chain of links (like a kid list,
+// or parent links) using Brent's algorithm: it keeps a mark that
+// moves to the current node after 1, 2, 4, 8, ... steps, and a
+// cycle exists if the chain reaches the mark. It finds a cycle
+// in at most a few times the cycle's length plus its tail.
+// The zero value is ready to use, at the start of a chain.
+type loopGuard struct {
+	mark         *Nord
+	power, steps int
+}
+
+// loops is called for each node in a chain, and is true if
+// the chain has reached a node that it reached before.
+func (g *loopGuard) loops(n Norder) bool {
+	nn := n.nord()
+	if nn == g.mark {
+		return true
+	}
+	g.steps++
+	if g.mark == nil || g.steps == g.power {
+		g.mark = nn
+		if g.power == 0 {
+			g.power = 1
+		}
+		g.power *= 2
+		g.steps = 0
+	}
+	return false
+}
+
+// kidIsAncestor is true if kid (a kid of p) is p itself or one of
+// p's ancestors, i.e. if descending into it would loop. It walks up
+// only if kid's parent link is not to p, which is never in a sound
+// tree, so normally it costs nothing.
+func kidIsAncestor(p, kid Norder) bool {
+	if sameNord(kid.Parent(), p) {
+		return false
+	}
+	var g loopGuard
+	for n, depth := p, 0; n != nil && depth <= MaxTreeDepth; depth++ {
+		if sameNord(n, kid) {
+			return true
+		}
+		if n = n.Parent(); n != nil && g.loops(n) {
+			return false
+		}
+	}
+	return false
+}
+
+// backLinkError is the error for a kid of p that is p's ancestor.
+func backLinkError(op string, p, kid Norder) error {
+	return fmt.Errorf("%s: <%s> has its ancestor <%s> as a kid: %w",
+		op, p.RelFP(), kid.RelFP(), ErrCycle)
+}
+
+// kidLoopError is the error for a loop in p's kid list.
+func kidLoopError(op string, p, kid Norder) error {
+	return fmt.Errorf("%s: kid list of <%s> loops at <%s>: %w",
+		op, p.RelFP(), kid.RelFP(), ErrCycle)
+}
+
+// tooDeepError is the error for exceeding MaxTreeDepth at p.
+func tooDeepError(op string, p Norder) error {
+	return fmt.Errorf("%s: at <%s>: %w", op, p.RelFP(), ErrTooDeep)
+}
@@ -0,0 +1,46 @@
+package orderednodes
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestWalkBackLink(t *testing.T) {
+	nop := func(Norder) error { return nil }
+	walkers := []struct {
+		name string
+		walk func(Norder) error
+	}{
+		{"InspectTree", func(r Norder) error {
+			return InspectTree(r, nop)
+		}},
+		{"InspectTreeWithPreAndPost", func(r Norder) error {
+			return InspectTreeWithPreAndPost(r, nop, nop)
+		}},
+		{"InspectTreeIteratively", func(r Norder) error {
+			return InspectTreeIteratively(r, nop)
+		}},
+		{"WalkNords", func(r Norder) error {
+			return WalkNords(r, func(string, fs.DirEntry, error) error {
+				return nil
+			})
+		}},
+		{"ParallelInspect", func(r Norder) error {
+			return ParallelInspect(r, 2, nop)
+		}},
+	}
+	for _, w := range walkers {
+		t.Run(w.name, func(t *testing.T) {
+			// r -> a -> b, and b's kid link goes back to a.
+			r := benchDeepTree(2)
+			a := r.FirstKid()
+			b := a.FirstKid()
+			b.SetFirstKid(a)
+			b.SetLastKid(a)
+			if e := w.walk(r); !errors.Is(e, ErrCycle) {
+				t.Errorf("got %v, want %v", e, ErrCycle)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package orderednodes
+
+import (
+	"fmt"
+	FP "path/filepath"
+	"strconv"
+	S "strings"
+
+	FU "github.com/fbaube/fileutils"
+)
+
+// ViolationKind names an invariant of a Nord tree.
+type ViolationKind string
+
+const (
+	// VioRoot: the root is not a root, or a non-root is.
+	VioRoot ViolationKind = "root"
+	// VioParent: a kid's parent link is not to its parent.
+	VioParent ViolationKind = "parent"
+	// VioSiblings: prev/next links are not symmetric.
+	VioSiblings ViolationKind = "siblings"
+	// VioEnds: firstKid/lastKid are not the ends of the kid list.
+	VioEnds ViolationKind = "ends"
+	// VioLevel: a level is not the parent's level + 1.
+	VioLevel ViolationKind = "level"
+	// VioRelPath: a relPath is not the parent's relPath + a name.
+	VioRelPath ViolationKind = "relpath"
+	// VioCycle: a node is reached twice (a cycle or a shared node).
+	VioCycle ViolationKind = "cycle"
+	// VioIDs: in a tree with IDs (see [AssignIDs]), a node's ID is
+	// missing, duplicated or not findable, or its list of its kids'
+	// IDs does not match its kid list.
+	VioIDs ViolationKind = "ids"
+)
+
+// Violation is a broken invariant in a Nord tree.
+type Violation struct {
+	Kind ViolationKind
+	// Nord is the offending node.
+	Nord Norder
+	Msg  string
+}
+
+func (v Violation) String() string {
+	var path = "<nil>"
+	if v.Nord != nil {
+		path = v.Nord.RelFP()
+	}
+	return fmt.Sprintf("%s: <%s>: %s", v.Kind, path, v.Msg)
+}
+
+// Verify checks the link invariants of the tree under (and including)
+// root, and returns every violation that it finds, or nil if there are
+// none. Because the Set* methods (like [Nord.SetNextKid]) have no side
+// effects, a tree can be damaged easily, so this is worth calling in
+// tests and after bulk edits. It checks that:
+//   - root is a root and has no parent, and no other node is a root
+//   - each kid's parent link is to its parent
+//   - prev/next links are symmetric
+//   - firstKid and lastKid are the ends of the kid list
+//   - each level is the parent's level + 1 (and the root's is 0)
+//   - each relPath is the parent's relPath plus one path element
+//   - no node is reached twice (which catches all cycles)
+//   - if the tree has IDs, each node has a unique ID that finds
+//     it, and its list of its kids' IDs matches its kid list
+//
+// Verify itself is not recursive, and it stops following links as
+// soon as it reaches a node for the second time, so it terminates
+// for any damaged tree.
+// .
+func Verify(root Norder) []Violation {
+	var vv []Violation
+	add := func(k ViolationKind, n Norder, f string, a ...any) {
+		vv = append(vv, Violation{Kind: k, Nord: n, Msg: fmt.Sprintf(f, a...)})
+	}
+	if root == nil {
+		add(VioRoot, nil, "root is nil")
+		return vv
+	}
+	if !root.IsRoot() {
+		add(VioRoot, root, "root is not marked as a root")
+	}
+	if root.Parent() != nil {
+		add(VioRoot, root, "root has a parent <%s>", root.Parent().RelFP())
+	}
+	if root.Level() != 0 {
+		add(VioLevel, root, "root has level %d", root.Level())
+	}
+	var seen = map[*Nord]bool{root.nord(): true}
+	var ids = root.nord().ids
+	var idSeen = make(map[int]bool)
+	checkID := func(n Norder) {
+		nn := n.nord()
+		switch {
+		case nn.ids != ids || nn.seqID == 0:
+			add(VioIDs, n, "has no ID in this tree")
+		case idSeen[nn.seqID]:
+			add(VioIDs, n, "ID %d is duplicated", nn.seqID)
+		case !sameNord(ids.byID[nn.seqID], n):
+			add(VioIDs, n, "ID %d finds <%s>", nn.seqID,
+				relFP(ids.byID[nn.seqID]))
+		}
+		idSeen[nn.seqID] = true
+	}
+	if ids != nil {
+		checkID(root)
+	}
+	var stack = []Norder{root}
+	for len(stack) > 0 {
+		par := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		// Kids are checked in order, and pushed in reverse
+		// order, so that violations are reported in preorder.
+		var kids []Norder
+		var prev Norder
+		fk, lk := par.FirstKid(), par.LastKid()
+		if (fk == nil) != (lk == nil) {
+			add(VioEnds, par, "only one of firstKid and lastKid is set")
+		}
+		if fk != nil && fk.PrevKid() != nil {
+			add(VioEnds, fk, "first kid has a prev kid <%s>",
+				fk.PrevKid().RelFP())
+		}
+		for k := fk; k != nil; k = k.NextKid() {
+			if seen[k.nord()] {
+				add(VioCycle, k, "reached again, as a kid of <%s>",
+					par.RelFP())
+				break
+			}
+			seen[k.nord()] = true
+			kids = append(kids, k)
+			if !sameNord(k.Parent(), par) {
+				add(VioParent, k, "parent is <%s> not <%s>",
+					relFP(k.Parent()), par.RelFP())
+			}
+			if prev != nil && !sameNord(k.PrevKid(), prev) {
+				add(VioSiblings, k, "prev kid is <%s> not <%s>",
+					relFP(k.PrevKid()), prev.RelFP())
+			}
+			if k.IsRoot() {
+				add(VioRoot, k, "a kid is marked as a root")
+			}
+			if k.Level() != par.Level()+1 {
+				add(VioLevel, k, "level is %d, parent's is %d",
+					k.Level(), par.Level())
+			}
+			if !relPathIsKidOf(k.RelFP(), par) {
+				add(VioRelPath, k, "relPath does not extend <%s>",
+					par.RelFP())
+			}
+			prev = k
+		}
+		if lk != nil && !sameNord(lk, prev) {
+			add(VioEnds, par, "last kid is <%s>, but the "+
+				"kid list ends at <%s>", lk.RelFP(), relFP(prev))
+		}
+		// If lk is not where the kid list ends, that is reported
+		// above; if it is, and it has a next kid, the list loops.
+		if lk != nil && lk.NextKid() != nil && sameNord(lk, prev) {
+			add(VioEnds, lk, "last kid has a next kid <%s>",
+				lk.NextKid().RelFP())
+		}
+		if ids != nil {
+			var sb S.Builder
+			sb.WriteString(",")
+			for _, k := range kids {
+				checkID(k)
+				sb.WriteString(strconv.Itoa(k.nord().seqID) + ",")
+			}
+			if got := par.nord().kidIdxsNow(); got != sb.String() {
+				add(VioIDs, par, "kid IDs are %q, but the "+
+					"kid list has %q", got, sb.String())
+			}
+		}
+		for i := len(kids) - 1; i >= 0; i-- {
+			stack = append(stack, kids[i])
+		}
+	}
+	return vv
+}
+
+// relPathIsKidOf is true if rel is the relPath of a kid of par. The
+// kids of a root have a single path element, because the root's own
+// relPath is special (it is the path to the dir or the document).
+func relPathIsKidOf(rel string, par Norder) bool {
+	rel = FU.StripTrailingPathSep(rel)
+	if rel == "" {
+		return false
+	}
+	dir := FP.Dir(rel)
+	if par.IsRoot() {
+		return dir == "."
+	}
+	return dir == FU.StripTrailingPathSep(par.RelFP())
+}
+
+// relFP is NPE-proof.
+func relFP(p Norder) string {
+	if p == nil {
+		return "<nil>"
+	}
+	return p.RelFP()
+}
@@ -0,0 +1,136 @@
+package orderednodes
+
+import (
+	"slices"
+	"testing"
+)
+
+// verifyTestTree returns a root with the kids a and b,
+// where a has the kids x, y and z.
+func verifyTestTree() *Nord {
+	r := &Nord{relPath: ".", absPath: "/r/", isRoot: true, isDir: true}
+	a := &Nord{relPath: "a", absPath: "/r/a/", isDir: true}
+	r.AddKid(a)
+	r.AddKid(&Nord{relPath: "b", absPath: "/r/b"})
+	a.AddKid(&Nord{relPath: "a/x", absPath: "/r/a/x"})
+	a.AddKid(&Nord{relPath: "a/y", absPath: "/r/a/y"})
+	a.AddKid(&Nord{relPath: "a/z", absPath: "/r/a/z"})
+	return r
+}
+
+// vioKinds returns the kinds of the violations, sorted, without dupes.
+func vioKinds(vv []Violation) []ViolationKind {
+	var kk []ViolationKind
+	for _, v := range vv {
+		kk = append(kk, v.Kind)
+	}
+	slices.Sort(kk)
+	return slices.Compact(kk)
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(r, a, x, y, z Norder)
+		want   []ViolationKind
+	}{
+		{"good", func(r, a, x, y, z Norder) {}, nil},
+		{"root not a root", func(r, a, x, y, z Norder) {
+			r.nord().isRoot = false
+		}, []ViolationKind{VioRoot}},
+		{"root has a parent", func(r, a, x, y, z Norder) {
+			r.SetParent(a)
+		}, []ViolationKind{VioRoot}},
+		{"kid is a root", func(r, a, x, y, z Norder) {
+			y.nord().isRoot = true
+		}, []ViolationKind{VioRoot}},
+		{"wrong parent", func(r, a, x, y, z Norder) {
+			z.SetParent(r)
+		}, []ViolationKind{VioParent}},
+		{"wrong prev kid", func(r, a, x, y, z Norder) {
+			z.SetPrevKid(x)
+		}, []ViolationKind{VioSiblings}},
+		{"first kid has a prev kid", func(r, a, x, y, z Norder) {
+			x.SetPrevKid(z)
+		}, []ViolationKind{VioEnds}},
+		{"wrong last kid", func(r, a, x, y, z Norder) {
+			a.SetLastKid(y)
+		}, []ViolationKind{VioEnds}},
+		{"no last kid", func(r, a, x, y, z Norder) {
+			a.SetLastKid(nil)
+		}, []ViolationKind{VioEnds}},
+		{"last kid loops", func(r, a, x, y, z Norder) {
+			z.SetNextKid(x)
+		}, []ViolationKind{VioEnds, VioCycle}},
+		{"shared kid", func(r, a, x, y, z Norder) {
+			r.LastKid().SetNextKid(y)
+		}, []ViolationKind{VioParent, VioSiblings, VioLevel,
+			VioRelPath, VioEnds, VioCycle}},
+		{"wrong level", func(r, a, x, y, z Norder) {
+			y.setLevel(5)
+		}, []ViolationKind{VioLevel}},
+		{"wrong relPath", func(r, a, x, y, z Norder) {
+			y.nord().relPath = "b/y"
+		}, []ViolationKind{VioRelPath}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := verifyTestTree()
+			a := r.FirstKid()
+			x := a.FirstKid()
+			tc.damage(r, a, x, x.NextKid(), a.LastKid())
+			var want, got = tc.want, vioKinds(Verify(r))
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", Verify(r), want)
+			}
+		})
+	}
+}
+
+func TestVerifyIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(r, x, y Norder)
+	}{
+		{"relinked", func(r, x, y Norder) {
+			// Swap x and y, using only the Set* methods.
+			a, z := x.Parent(), y.NextKid()
+			a.SetFirstKid(y)
+			y.SetPrevKid(nil)
+			y.SetNextKid(x)
+			x.SetPrevKid(y)
+			x.SetNextKid(z)
+			z.SetPrevKid(x)
+		}},
+		{"no ID", func(r, x, y Norder) {
+			y.nord().seqID = 0
+		}},
+		{"duplicate ID", func(r, x, y Norder) {
+			y.nord().seqID = x.SeqID()
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := verifyTestTree()
+			if e := AssignIDs(r); e != nil {
+				t.Fatal(e)
+			}
+			if vv := Verify(r); vv != nil {
+				t.Fatalf("before: %v", vv)
+			}
+			x := r.FirstKid().FirstKid()
+			tc.damage(r, x, x.NextKid())
+			got := vioKinds(Verify(r))
+			if !slices.Equal(got, []ViolationKind{VioIDs}) {
+				t.Errorf("got %v, want %v", Verify(r), VioIDs)
+			}
+		})
+	}
+}
+
+func TestVerifyNil(t *testing.T) {
+	if got := vioKinds(Verify(nil)); !slices.Equal(got, []ViolationKind{VioRoot}) {
+		t.Errorf("got %v", got)
+	}
+}
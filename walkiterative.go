@@ -0,0 +1,217 @@
+package orderednodes
+
+// This file has non-recursive versions of the tree walkers, which use
+// an explicit stack (one small frame per level) instead of the call
+// stack, so that walking pathologically deep trees (like a generated
+// XML document, or a chain of 100,000 levels) neither grows the
+// goroutine stack nor allocates much. Their callback semantics are
+// identical to those of the recursive versions, including the order
+// of the calls and the handling of errors.
+
+import (
+	"io/fs"
+	"os"
+	FP "path/filepath"
+	"sync"
+)
+
+// inspectFrame is a Nord whose kids are being visited.
+type inspectFrame struct {
+	par  Norder
+	next Norder
+}
+
+// inspectStack is the state of an iterative walk: a frame per level,
+// plus (kept apart, to keep the frames small) a guard per level for
+// its kid list. Stacks are pooled, so that walking a deep tree many
+// times does not allocate (and grow) a big stack every time.
+type inspectStack struct {
+	frames []inspectFrame
+	guards []loopGuard
+	// used is how much of frames was used, so that
+	// only that much is cleared when it is put back.
+	used int
+}
+
+// maxPooledFrames is the largest stack that is put back into the
+// pool, so that one pathological tree does not pin its memory.
+const maxPooledFrames = 1 << 16
+
+var inspectStacks = sync.Pool{
+	New: func() any { return new(inspectStack) },
+}
+
+func (st *inspectStack) push(par, next Norder) {
+	st.frames = append(st.frames, inspectFrame{par, next})
+	st.guards = append(st.guards, loopGuard{})
+	st.used = max(st.used, len(st.frames))
+}
+
+func (st *inspectStack) pop() {
+	st.frames = st.frames[:len(st.frames)-1]
+	st.guards = st.guards[:len(st.guards)-1]
+}
+
+// release clears the stack (so that it does
+// not keep Nords alive) and pools it.
+func (st *inspectStack) release() {
+	if cap(st.frames) > maxPooledFrames {
+		return
+	}
+	clear(st.frames[:st.used])
+	st.frames, st.guards, st.used = st.frames[:0], st.guards[:0], 0
+	inspectStacks.Put(st)
+}
+
+// InspectTreeIteratively is a non-recursive [InspectTree].
+func InspectTreeIteratively(p Norder, f InspectorFunc) error {
+	return inspectTreeIteratively(p, f, nil, "InspectTreeIteratively")
+}
+
+// InspectTreeWithPreAndPostIteratively is a
+// non-recursive [InspectTreeWithPreAndPost].
+func InspectTreeWithPreAndPostIteratively(p Norder,
+	f0 InspectorFunc, f1 InspectorFunc) error {
+	return inspectTreeIteratively(p, f0, f1,
+		"InspectTreeWithPreAndPostIteratively")
+}
+
+// inspectTreeIteratively calls f0 (pre) and f1 (post, if not nil).
+func inspectTreeIteratively(p Norder, f0, f1 InspectorFunc, op string) error {
+	e := inspectTreeIterativelyUntil(p, f0, f1, op)
+	if e == SkipAll {
+		return nil
+	}
+	return e
+}
+
+func inspectTreeIterativelyUntil(p Norder, f0, f1 InspectorFunc, op string) error {
+	st := inspectStacks.Get().(*inspectStack)
+	defer st.release()
+	// pre calls f0 and, unless it returns an error,
+	// pushes a frame for n's kids (none if skipped).
+	pre := func(n Norder) error {
+		e := f0(n)
+		if e != nil && e != SkipDir {
+			return e
+		}
+		var first Norder
+		if e == nil {
+			first = n.FirstKid()
+		}
+		st.push(n, first)
+		return nil
+	}
+	if e := pre(p); e != nil {
+		return e
+	}
+	for len(st.frames) > 0 {
+		top := &st.frames[len(st.frames)-1]
+		if top.next == nil {
+			// All kids done: POST
+			if f1 != nil {
+				if e := f1(top.par); e != nil && e != SkipDir {
+					return e
+				}
+			}
+			st.pop()
+			continue
+		}
+		pKid := top.next
+		if st.guards[len(st.guards)-1].loops(pKid) {
+			return kidLoopError(op, top.par, pKid)
+		}
+		if kidIsAncestor(top.par, pKid) {
+			return backLinkError(op, top.par, pKid)
+		}
+		top.next = pKid.NextKid()
+		if len(st.frames) > MaxTreeDepth {
+			return tooDeepError(op, pKid)
+		}
+		if e := pre(pKid); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// WalkNorderTreeIteratively is a non-recursive [WalkNorderTree].
+func WalkNorderTreeIteratively(root Norder, fn fs.WalkDirFunc) error {
+	info, err := os.Lstat(root.AbsFP())
+	if err != nil {
+		err = fn(root.AbsFP(), nil, err)
+	} else {
+		err = walkDirIteratively(root.AbsFP(), fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == SkipDir || err == SkipAll {
+		return nil
+	}
+	return err
+}
+
+// dirFrame is a directory whose entries are being walked.
+type dirFrame struct {
+	path string
+	ents []fs.DirEntry
+	i    int
+}
+
+// walkDirIteratively is a non-recursive walkDir.
+func walkDirIteratively(path string, d fs.DirEntry, walkDirFn fs.WalkDirFunc) error {
+	ents, descend, err := enterDir(path, d, walkDirFn)
+	if err != nil || !descend {
+		return err
+	}
+	var stack = []dirFrame{{path: path, ents: ents}}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.i >= len(top.ents) {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		d1 := top.ents[top.i]
+		top.i++
+		path1 := FP.Join(top.path, d1.Name())
+		ents, descend, err = enterDir(path1, d1, walkDirFn)
+		if err != nil {
+			if err == SkipDir {
+				// Skip the rest of this directory.
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			return err
+		}
+		if descend {
+			if len(stack) > MaxTreeDepth {
+				return &fs.PathError{Op: "walk", Path: path1, Err: ErrTooDeep}
+			}
+			stack = append(stack, dirFrame{path: path1, ents: ents})
+		}
+	}
+	return nil
+}
+
+// enterDir is the part of walkDir that precedes its loop over
+// the entries: it calls walkDirFn, and for a directory, reads
+// it. descend is true if the entries should be walked.
+func enterDir(path string, d fs.DirEntry, walkDirFn fs.WalkDirFunc) (ents []fs.DirEntry, descend bool, err error) {
+	if err = walkDirFn(path, d, nil); err != nil || !d.IsDir() {
+		if err == SkipDir && d.IsDir() {
+			// Successfully skipped directory.
+			err = nil
+		}
+		return nil, false, err
+	}
+	ents, err = os.ReadDir(path)
+	if err != nil {
+		// Second call, to report ReadDir error.
+		err = walkDirFn(path, d, err)
+		if err != nil {
+			if err == SkipDir && d.IsDir() {
+				err = nil
+			}
+			return nil, false, err
+		}
+	}
+	return ents, true, nil
+}
@@ -0,0 +1,160 @@
+package orderednodes
+
+import (
+	"io/fs"
+	"os"
+	FP "path/filepath"
+	"strconv"
+	"testing"
+)
+
+// benchWideTree returns a tree of depth levels below the
+// root, in which every Nord above the bottom has fanOut kids.
+func benchWideTree(depth, fanOut int) *Nord {
+	root := &Nord{relPath: "root", isRoot: true}
+	var grow func(p *Nord, level int)
+	grow = func(p *Nord, level int) {
+		if level == depth {
+			return
+		}
+		for i := 0; i < fanOut; i++ {
+			k := &Nord{relPath: strconv.Itoa(i)}
+			p.AddKid(k)
+			grow(k, level+1)
+		}
+	}
+	grow(root, 0)
+	return root
+}
+
+// benchDeepTree returns a chain of depth Nords below the root.
+func benchDeepTree(depth int) *Nord {
+	root := &Nord{relPath: "root", isRoot: true}
+	p := root
+	for i := 0; i < depth; i++ {
+		k := &Nord{relPath: "k"}
+		p.AddKid(k)
+		p = k
+	}
+	return root
+}
+
+var benchTrees = []struct {
+	name string
+	make func() *Nord
+}{
+	{"wide", func() *Nord { return benchWideTree(3, 40) }},
+	{"deep", func() *Nord { return benchDeepTree(50000) }},
+}
+
+func BenchmarkInspectTree(b *testing.B) {
+	count := func(n *int) InspectorFunc {
+		return func(Norder) error { *n++; return nil }
+	}
+	for _, bt := range benchTrees {
+		root := bt.make()
+		b.Run(bt.name+"/recursive", func(b *testing.B) {
+			var n int
+			for i := 0; i < b.N; i++ {
+				if e := InspectTree(root, count(&n)); e != nil {
+					b.Fatal(e)
+				}
+			}
+		})
+		b.Run(bt.name+"/iterative", func(b *testing.B) {
+			var n int
+			for i := 0; i < b.N; i++ {
+				if e := InspectTreeIteratively(root, count(&n)); e != nil {
+					b.Fatal(e)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInspectTreeWithPreAndPost(b *testing.B) {
+	count := func(n *int) InspectorFunc {
+		return func(Norder) error { *n++; return nil }
+	}
+	for _, bt := range benchTrees {
+		root := bt.make()
+		b.Run(bt.name+"/recursive", func(b *testing.B) {
+			var n int
+			for i := 0; i < b.N; i++ {
+				e := InspectTreeWithPreAndPost(root, count(&n), count(&n))
+				if e != nil {
+					b.Fatal(e)
+				}
+			}
+		})
+		b.Run(bt.name+"/iterative", func(b *testing.B) {
+			var n int
+			for i := 0; i < b.N; i++ {
+				e := InspectTreeWithPreAndPostIteratively(root,
+					count(&n), count(&n))
+				if e != nil {
+					b.Fatal(e)
+				}
+			}
+		})
+	}
+}
+
+// benchDirTree makes (under a temp dir) a tree of dirs of depth levels
+// below the root, in which every dir above the bottom has fanOut dirs
+// plus one file, and returns a root Nord for it.
+func benchDirTree(b *testing.B, depth, fanOut int) Norder {
+	b.Helper()
+	var grow func(dir string, level int)
+	grow = func(dir string, level int) {
+		if level == depth {
+			return
+		}
+		if e := os.WriteFile(FP.Join(dir, "f"), nil, 0644); e != nil {
+			b.Fatal(e)
+		}
+		for i := 0; i < fanOut; i++ {
+			d := FP.Join(dir, strconv.Itoa(i))
+			if e := os.Mkdir(d, 0755); e != nil {
+				b.Fatal(e)
+			}
+			grow(d, level+1)
+		}
+	}
+	root := b.TempDir()
+	grow(root, 0)
+	return NewRootNord(root, nil)
+}
+
+func BenchmarkWalkNorderTree(b *testing.B) {
+	count := func(n *int) fs.WalkDirFunc {
+		return func(string, fs.DirEntry, error) error { *n++; return nil }
+	}
+	var trees = []struct {
+		name          string
+		depth, fanOut int
+	}{
+		{"wide", 3, 10},
+		// Deep, but well within PATH_MAX.
+		{"deep", 500, 1},
+	}
+	for _, bt := range trees {
+		root := benchDirTree(b, bt.depth, bt.fanOut)
+		b.Run(bt.name+"/recursive", func(b *testing.B) {
+			var n int
+			for i := 0; i < b.N; i++ {
+				if e := WalkNorderTree(root, count(&n)); e != nil {
+					b.Fatal(e)
+				}
+			}
+		})
+		b.Run(bt.name+"/iterative", func(b *testing.B) {
+			var n int
+			for i := 0; i < b.N; i++ {
+				if e := WalkNorderTreeIteratively(root, count(&n)); e != nil {
+					b.Fatal(e)
+				}
+			}
+		})
+	}
+}
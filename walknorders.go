@@ -3,15 +3,44 @@ package orderednodes
 type InspectorFunc func(pNode Norder) error
 
 // func InspectTree used to be func WalkNorders
+//
+// If f returns [SkipDir], the node's kids are skipped (but not its
+// siblings, unlike for [fs.WalkDir]). If f returns [SkipAll], the
+// walk stops, and InspectTree returns nil. Any other error stops
+// the walk and is returned.
+//
+// It returns an error that wraps [ErrCycle] if a kid list loops or
+// a kid link points back to an ancestor, or [ErrTooDeep] if it goes
+// more than [MaxTreeDepth] levels down.
 // .
 func InspectTree(p Norder, f InspectorFunc) error {
+	if e := inspectTree(p, f, 0); e != SkipAll {
+		return e
+	}
+	return nil
+}
+
+func inspectTree(p Norder, f InspectorFunc, depth int) error {
 	var e error
+	if depth > MaxTreeDepth {
+		return tooDeepError("InspectTree", p)
+	}
 	if e = f(p); e != nil {
+		if e == SkipDir {
+			return nil
+		}
 		return e
 	}
+	var g loopGuard
 	pKid := p.FirstKid()
 	for pKid != nil {
-		if e = InspectTree(pKid, f); e != nil {
+		if g.loops(pKid) {
+			return kidLoopError("InspectTree", p, pKid)
+		}
+		if kidIsAncestor(p, pKid) {
+			return backLinkError("InspectTree", p, pKid)
+		}
+		if e = inspectTree(pKid, f, depth+1); e != nil {
 			return e
 		}
 		pKid = pKid.NextKid()
@@ -19,24 +48,56 @@ func InspectTree(p Norder, f InspectorFunc) error {
 	return nil
 }
 
+// InspectTreeWithPreAndPost is like [InspectTree], but it
+// calls f0 before visiting a node's kids, and f1 after.
+//
+// If f0 returns [SkipDir], the node's kids are skipped, but f1
+// is still called for the node, so that every f0 is matched by
+// an f1 (as for balanced start and end tags). If f1 returns
+// SkipDir, it is ignored, because the kids are done already.
+//
+// If f0 or f1 returns [SkipAll], the walk stops at once (so
+// no more f1 calls are made for the nodes that are still
+// open), and InspectTreeWithPreAndPost returns nil.
+// .
 func InspectTreeWithPreAndPost(p Norder,
 	f0 InspectorFunc, f1 InspectorFunc) error {
+	if e := inspectTreeWithPreAndPost(p, f0, f1, 0); e != SkipAll {
+		return e
+	}
+	return nil
+}
+
+func inspectTreeWithPreAndPost(p Norder,
+	f0 InspectorFunc, f1 InspectorFunc, depth int) error {
 
 	var e error
+	if depth > MaxTreeDepth {
+		return tooDeepError("InspectTreeWithPreAndPost", p)
+	}
 	// PRE
-	if e = f0(p); e != nil {
+	e = f0(p)
+	skipKids := e == SkipDir
+	if e != nil && !skipKids {
 		return e
 	}
 	// KIDS
+	var g loopGuard
 	pKid := p.FirstKid()
-	for pKid != nil {
-		if e = InspectTreeWithPreAndPost(pKid, f0, f1); e != nil {
+	for pKid != nil && !skipKids {
+		if g.loops(pKid) {
+			return kidLoopError("InspectTreeWithPreAndPost", p, pKid)
+		}
+		if kidIsAncestor(p, pKid) {
+			return backLinkError("InspectTreeWithPreAndPost", p, pKid)
+		}
+		if e = inspectTreeWithPreAndPost(pKid, f0, f1, depth+1); e != nil {
 			return e
 		}
 		pKid = pKid.NextKid()
 	}
 	// POST
-	if e = f1(p); e != nil {
+	if e = f1(p); e != nil && e != SkipDir {
 		return e
 	}
 	return nil
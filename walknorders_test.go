@@ -0,0 +1,123 @@
+package orderednodes
+
+import (
+	"errors"
+	S "strings"
+	"testing"
+)
+
+// skipTestTree returns a root with the kids a and b,
+// where a has the kids x and y, and b has the kid z.
+func skipTestTree() *Nord {
+	r := &Nord{relPath: ".", absPath: "/r/", isRoot: true, isDir: true}
+	a := &Nord{relPath: "a", absPath: "/r/a/", isDir: true}
+	b := &Nord{relPath: "b", absPath: "/r/b/", isDir: true}
+	r.AddKid(a)
+	r.AddKid(b)
+	a.AddKid(&Nord{relPath: "a/x", absPath: "/r/a/x"})
+	a.AddKid(&Nord{relPath: "a/y", absPath: "/r/a/y"})
+	b.AddKid(&Nord{relPath: "b/z", absPath: "/r/b/z"})
+	return r
+}
+
+func TestInspectSkip(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name string
+		// at and ret say what the pre (or post, if post)
+		// func returns for the Nord whose relPath is at.
+		at   string
+		post bool
+		ret  error
+		// want is the calls, with "+" for pre and "-" for post.
+		want    string
+		wantErr error
+	}{
+		{"all", "", false, nil,
+			"+. +a +a/x -a/x +a/y -a/y -a +b +b/z -b/z -b -.", nil},
+		{"SkipDir", "a", false, SkipDir,
+			"+. +a -a +b +b/z -b/z -b -.", nil},
+		{"SkipDir on a leaf", "a/x", false, SkipDir,
+			"+. +a +a/x -a/x +a/y -a/y -a +b +b/z -b/z -b -.", nil},
+		{"SkipDir on the root", ".", false, SkipDir, "+. -.", nil},
+		{"SkipAll", "a/x", false, SkipAll, "+. +a +a/x", nil},
+		{"SkipAll on the root", ".", false, SkipAll, "+.", nil},
+		{"error", "a/y", false, errStop,
+			"+. +a +a/x -a/x +a/y", errStop},
+		{"SkipDir in post", "a", true, SkipDir,
+			"+. +a +a/x -a/x +a/y -a/y -a +b +b/z -b/z -b -.", nil},
+		{"SkipAll in post", "a", true, SkipAll,
+			"+. +a +a/x -a/x +a/y -a/y -a", nil},
+		{"error in post", "a/x", true, errStop,
+			"+. +a +a/x -a/x", errStop},
+	}
+	inspectors := []struct {
+		name string
+		f    func(Norder, InspectorFunc, InspectorFunc) error
+	}{
+		{"recursive", InspectTreeWithPreAndPost},
+		{"iterative", InspectTreeWithPreAndPostIteratively},
+	}
+	for _, tc := range tests {
+		for _, in := range inspectors {
+			t.Run(tc.name+"/"+in.name, func(t *testing.T) {
+				var calls []string
+				visit := func(sign string, post bool) InspectorFunc {
+					return func(p Norder) error {
+						calls = append(calls, sign+p.RelFP())
+						if p.RelFP() == tc.at && post == tc.post {
+							return tc.ret
+						}
+						return nil
+					}
+				}
+				e := in.f(skipTestTree(), visit("+", false), visit("-", true))
+				if got := S.Join(calls, " "); got != tc.want {
+					t.Errorf("got %s\nwant %s", got, tc.want)
+				}
+				if e != tc.wantErr {
+					t.Errorf("got error %v, want %v", e, tc.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestInspectSkipPreOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		at   string
+		ret  error
+		want string
+	}{
+		{"SkipDir", "a", SkipDir, ". a b b/z"},
+		{"SkipAll", "a/y", SkipAll, ". a a/x a/y"},
+	}
+	inspectors := []struct {
+		name string
+		f    func(Norder, InspectorFunc) error
+	}{
+		{"recursive", InspectTree},
+		{"iterative", InspectTreeIteratively},
+	}
+	for _, tc := range tests {
+		for _, in := range inspectors {
+			t.Run(tc.name+"/"+in.name, func(t *testing.T) {
+				var calls []string
+				e := in.f(skipTestTree(), func(p Norder) error {
+					calls = append(calls, p.RelFP())
+					if p.RelFP() == tc.at {
+						return tc.ret
+					}
+					return nil
+				})
+				if got := S.Join(calls, " "); got != tc.want {
+					t.Errorf("got %s, want %s", got, tc.want)
+				}
+				if e != nil {
+					t.Errorf("got error %v", e)
+				}
+			})
+		}
+	}
+}
@@ -47,6 +47,11 @@ var SkipAll error = fs.SkipAll
 //
 // The paths associated with the `Norder`s are, at each level downward,
 // pretty much assumed to be in lexical order.
+//
+// NOTE that this uses only root.AbsFP(), and then reads the filesystem
+// (with [os.Lstat] and [os.ReadDir]); it ignores the Norder's kids.
+// To walk the Nords themselves, use [WalkNords], and to walk them
+// while checking them against the filesystem, [WalkNordsAgainstDisk].
 // .
 func WalkNorderTree(root Norder, fn fs.WalkDirFunc) error {
 	info, err := os.Lstat(root.AbsFP())
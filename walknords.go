@@ -0,0 +1,204 @@
+package orderednodes
+
+// This file walks the actual in-memory tree of Nords, in kid order,
+// using the same callback type as [fs.WalkDir], so that code written
+// for a filesystem walk can be used as-is. Compare [WalkNorderTree],
+// which uses only the root's path, and then reads the filesystem.
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	FP "path/filepath"
+	"time"
+
+	FU "github.com/fbaube/fileutils"
+)
+
+// ErrNotInTree is passed to the callback of [WalkNordsAgainstDisk]
+// for an item that is on disk but has no Nord in the tree.
+var ErrNotInTree = errors.New("on disk but not in Nord tree")
+
+// WalkNords walks the tree of Nords under (and including) root, in
+// kid order, calling fn for each Nord. It does not touch the disk.
+//
+// The path passed to fn is the Nord's [Norder.AbsFP] (without any
+// trailing separator), and the [fs.DirEntry] is synthesized from the
+// Nord (see [NordDirEntry]). The error passed to fn is always nil.
+//
+// fn's return value works as for [fs.WalkDir]: [SkipDir] skips a
+// dirlike Nord's kids, or else the rest of its siblings, and [SkipAll]
+// stops the walk. Any other error stops the walk and is returned.
+// Kids are walked if a Nord is dirlike, i.e. it [Norder.IsDir] or it
+// has kids (as a ToC entry or markup element can).
+// .
+func WalkNords(root Norder, fn fs.WalkDirFunc) error {
+	return walkNords(root, fn, false)
+}
+
+// WalkNordsAgainstDisk is like [WalkNords], but it also reconciles
+// each Nord against the disk:
+//   - The [fs.DirEntry] passed to fn is from [os.Lstat] of the Nord's
+//     path, so it reflects the disk. But if Lstat fails, fn gets the
+//     synthesized DirEntry plus the error (typically one that satisfies
+//     `errors.Is(err, fs.ErrNotExist)`), and if fn returns nil, the
+//     walk goes on to the Nord's kids.
+//   - For a directory, right after fn is called for it, fn is called
+//     for each of its disk entries (in lexical order) that does not
+//     have a kid with the same name, with the disk entry and an error
+//     [ErrNotInTree]. For these calls, SkipDir is ignored.
+//
+// .
+func WalkNordsAgainstDisk(root Norder, fn fs.WalkDirFunc) error {
+	return walkNords(root, fn, true)
+}
+
+// nordFrame is a Nord whose kids are being walked.
+type nordFrame struct {
+	par  Norder
+	next Norder
+	g    loopGuard
+}
+
+func walkNords(root Norder, fn fs.WalkDirFunc, checkDisk bool) error {
+	var stack []nordFrame
+	// visit calls fn for n (and for any of its disk entries that are
+	// not in the tree) and if appropriate, pushes a frame for its kids.
+	visit := func(n Norder) error {
+		path := FU.StripTrailingPathSep(n.AbsFP())
+		var d fs.DirEntry = NordDirEntry{n}
+		var err error
+		if checkDisk {
+			var fi fs.FileInfo
+			if fi, err = os.Lstat(path); err == nil {
+				d = fs.FileInfoToDirEntry(fi)
+			}
+		}
+		isDir := d.IsDir() || n.HasKids()
+		if e := fn(path, d, err); e != nil {
+			if e == SkipDir && isDir {
+				return nil
+			}
+			return e
+		}
+		if checkDisk && err == nil && d.IsDir() {
+			if e := walkDiskExtras(n, path, fn); e != nil {
+				return e
+			}
+		}
+		if isDir {
+			stack = append(stack, nordFrame{par: n, next: n.FirstKid()})
+		}
+		return nil
+	}
+	var e = visit(root)
+	for e == nil && len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.next == nil {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		kid := top.next
+		if top.g.loops(kid) {
+			return kidLoopError("WalkNords", top.par, kid)
+		}
+		if kidIsAncestor(top.par, kid) {
+			return backLinkError("WalkNords", top.par, kid)
+		}
+		top.next = kid.NextKid()
+		if len(stack) > MaxTreeDepth {
+			return tooDeepError("WalkNords", kid)
+		}
+		if e = visit(kid); e == SkipDir {
+			// Skip the rest of the siblings.
+			stack = stack[:len(stack)-1]
+			e = nil
+		}
+	}
+	if e == SkipDir || e == SkipAll {
+		return nil
+	}
+	return e
+}
+
+// walkDiskExtras calls fn for each disk entry in the directory
+// of n that has no kid in n.
+func walkDiskExtras(n Norder, path string, fn fs.WalkDirFunc) error {
+	ents, err := os.ReadDir(path)
+	if err != nil {
+		if e := fn(path, NordDirEntry{n}, err); e != nil && e != SkipDir {
+			return e
+		}
+		return nil
+	}
+	var names = make(map[string]bool)
+	for k := n.FirstKid(); k != nil; k = k.NextKid() {
+		names[NordDirEntry{k}.Name()] = true
+	}
+	for _, de := range ents {
+		if names[de.Name()] {
+			continue
+		}
+		if e := fn(FP.Join(path, de.Name()), de, ErrNotInTree); e != nil && e != SkipDir {
+			return e
+		}
+	}
+	return nil
+}
+
+// NordDirEntry is an [fs.DirEntry] for a Nord. Its name is the last
+// element of the Nord's relPath, and it is a dir if the Nord says so.
+// If the Nord has file info (i.e. it has a method `DirEntryInfo()
+// fs.FileInfo`, as [fileutils.FSItem] does), Info returns that;
+// otherwise it returns a minimal synthesized [fs.FileInfo] whose
+// Sys() is the Nord.
+// .
+type NordDirEntry struct {
+	Nord Norder
+}
+
+func (de NordDirEntry) Name() string {
+	if de.Nord.IsRoot() {
+		return FP.Base(FU.StripTrailingPathSep(de.Nord.AbsFP()))
+	}
+	return FP.Base(FU.StripTrailingPathSep(de.Nord.RelFP()))
+}
+
+func (de NordDirEntry) IsDir() bool { return de.Nord.IsDir() }
+
+func (de NordDirEntry) Type() fs.FileMode {
+	if fi := nordFileInfo(de.Nord); fi != nil {
+		return fi.Mode().Type()
+	}
+	if de.IsDir() {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (de NordDirEntry) Info() (fs.FileInfo, error) {
+	if fi := nordFileInfo(de.Nord); fi != nil {
+		return fi, nil
+	}
+	return synthFileInfo{de}, nil
+}
+
+// nordFileInfo returns the Nord's own file info, if it has any.
+func nordFileInfo(n Norder) fs.FileInfo {
+	if fier, ok := n.(interface{ DirEntryInfo() fs.FileInfo }); ok {
+		return fier.DirEntryInfo()
+	}
+	return nil
+}
+
+// synthFileInfo is the fs.FileInfo of a Nord that has none.
+type synthFileInfo struct {
+	de NordDirEntry
+}
+
+func (fi synthFileInfo) Name() string       { return fi.de.Name() }
+func (fi synthFileInfo) Size() int64        { return 0 }
+func (fi synthFileInfo) Mode() fs.FileMode  { return fi.de.Type() }
+func (fi synthFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi synthFileInfo) IsDir() bool        { return fi.de.IsDir() }
+func (fi synthFileInfo) Sys() any           { return fi.de.Nord }
@@ -0,0 +1,316 @@
+package orderednodes
+
+// This file keeps a tree built from a directory (as by [NewDirTree])
+// up to date with the disk while the program runs, and reports each
+// change on a channel. On Linux it uses inotify (see watch_linux.go);
+// elsewhere, or if inotify is not available (for example, when the
+// limit on watches is reached), it polls using [ReconcileWith].
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	S "strings"
+	"sync"
+	"time"
+
+	FU "github.com/fbaube/fileutils"
+	L "github.com/fbaube/mlog"
+)
+
+// ChangeKind says how an item changed.
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// ChangeEvent is a change that a [Watcher] made to its tree. For
+// ChangeAdded and ChangeRemoved, Nord is the top of the subtree that
+// was added or removed. A rename is reported as a removal plus an
+// addition. A removed Nord is no longer linked into the tree, but
+// its paths are still valid.
+type ChangeEvent struct {
+	Kind ChangeKind
+	Nord Norder
+}
+
+// WatchOptions configures [NewWatcher].
+// A nil *WatchOptions is the same as the zero value.
+type WatchOptions struct {
+	// DirTree is used to make Nords for new items.
+	DirTree *DirTreeOptions
+	// Poll says to poll even if inotify is available.
+	Poll bool
+	// PollInterval defaults to 2 seconds.
+	PollInterval time.Duration
+	// EventBuffer is the capacity of the Events channel.
+	EventBuffer int
+}
+
+// Watcher keeps a tree of Nords up to date with the disk. Because it
+// modifies the tree from its own goroutine, any other code that reads
+// (or walks) the tree must do so while holding [Watcher.RLock], and
+// must not modify the tree at all. Readers may still call funcs that
+// fill caches (such as [Norder.KidsAsSlice], [MerkleDigest], and the
+// loading of lazy dirs and of file contents), because those caches
+// have locks of their own.
+type Watcher struct {
+	// Events gets a ChangeEvent for each change to the tree, in
+	// the order they were made. It must be drained, because the
+	// Watcher waits until each event is received. It is closed
+	// by [Watcher.Close].
+	Events <-chan ChangeEvent
+	// Errors gets errors that do not stop the Watcher. If nobody
+	// is receiving, an error is logged instead. It is closed by
+	// [Watcher.Close].
+	Errors <-chan error
+
+	root      Norder
+	opts      WatchOptions
+	mu        sync.RWMutex
+	events    chan ChangeEvent
+	errs      chan error
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	polling   bool
+	// stopNotify (if not nil) wakes up the notify
+	// goroutine, which then returns and cleans up.
+	stopNotify func()
+}
+
+// NewWatcher starts watching the directory tree of root, which must
+// be the root of a tree built from a directory, with its Nords' kids
+// in lexical order. The tree is not reconciled first, so changes made
+// before the call are not seen until the items are changed again.
+func NewWatcher(root Norder, opts *WatchOptions) (*Watcher, error) {
+	w := &Watcher{root: root}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.PollInterval <= 0 {
+		w.opts.PollInterval = 2 * time.Second
+	}
+	w.events = make(chan ChangeEvent, w.opts.EventBuffer)
+	w.errs = make(chan error, 1)
+	w.done = make(chan struct{})
+	w.Events, w.Errors = w.events, w.errs
+	if !w.opts.Poll {
+		e := w.startNotify()
+		if e == nil {
+			return w, nil
+		}
+		L.L.Warning("NewWatcher: polling, because: %s", e.Error())
+	}
+	w.polling = true
+	w.startPolling()
+	return w, nil
+}
+
+// Polling is true if the Watcher polls, rather than using inotify.
+func (w *Watcher) Polling() bool { return w.polling }
+
+// Root returns the root of the tree being watched.
+func (w *Watcher) Root() Norder { return w.root }
+
+// RLock locks the tree for reading.
+func (w *Watcher) RLock() { w.mu.RLock() }
+
+// RUnlock undoes RLock.
+func (w *Watcher) RUnlock() { w.mu.RUnlock() }
+
+// Close stops the Watcher and closes its channels.
+// The tree is left as it is. Close is idempotent.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		if w.stopNotify != nil {
+			w.stopNotify()
+		}
+		w.wg.Wait()
+		close(w.events)
+		close(w.errs)
+	})
+	return nil
+}
+
+// emit sends the events, and is false if the Watcher is closed.
+func (w *Watcher) emit(evs []ChangeEvent) bool {
+	for _, ev := range evs {
+		select {
+		case w.events <- ev:
+		case <-w.done:
+			return false
+		}
+	}
+	return true
+}
+
+// report sends e to Errors, or logs it.
+func (w *Watcher) report(e error) {
+	if e == nil {
+		return
+	}
+	select {
+	case w.errs <- e:
+	default:
+		L.L.Error("Watcher: %s", e.Error())
+	}
+}
+
+// events lists the changes as events.
+func (c Changes) events() []ChangeEvent {
+	var evs []ChangeEvent
+	for _, n := range c.Removed {
+		evs = append(evs, ChangeEvent{ChangeRemoved, n})
+	}
+	for _, n := range c.Added {
+		evs = append(evs, ChangeEvent{ChangeAdded, n})
+	}
+	for _, n := range c.Modified {
+		evs = append(evs, ChangeEvent{ChangeModified, n})
+	}
+	return evs
+}
+
+// fileStamp is what polling compares to detect a modified file.
+type fileStamp struct {
+	size  int64
+	mtime time.Time
+}
+
+// startPolling starts a goroutine that reconciles the whole
+// tree every PollInterval. Since most Nords carry no file info,
+// it keeps its own record of each file's size and mtime.
+func (w *Watcher) startPolling() {
+	w.mu.RLock()
+	var stamps = w.stampFiles(nil, nil)
+	w.mu.RUnlock()
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		t := time.NewTicker(w.opts.PollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-t.C:
+			}
+			w.mu.Lock()
+			c, e := ReconcileWith(w.root, w.opts.DirTree)
+			var isNew = make(map[*Nord]bool)
+			for _, n := range c.Modified {
+				isNew[n.nord()] = true
+			}
+			stamps = w.stampFiles(stamps, func(n Norder, fi fs.FileInfo) {
+				if !isNew[n.nord()] {
+					c.Modified = append(c.Modified, n)
+					refreshNordInfo(n, fi)
+				}
+			})
+			w.mu.Unlock()
+			w.report(e)
+			if !w.emit(c.events()) {
+				return
+			}
+		}
+	}()
+}
+
+// stampFiles returns the stamps of all the files in the tree, and
+// calls changed (if not nil) for each one whose stamp differs from
+// the one in old, with its new file info. The caller must hold a lock.
+func (w *Watcher) stampFiles(old map[*Nord]fileStamp, changed func(Norder, fs.FileInfo)) map[*Nord]fileStamp {
+	var stamps = make(map[*Nord]fileStamp, len(old))
+	InspectTree(w.root, func(n Norder) error {
+		if n.IsDir() {
+			return nil
+		}
+		fi, e := os.Lstat(n.AbsFP())
+		if e != nil {
+			return nil
+		}
+		st := fileStamp{fi.Size(), fi.ModTime()}
+		stamps[n.nord()] = st
+		if was, ok := old[n.nord()]; ok && changed != nil &&
+			(was.size != st.size || !was.mtime.Equal(st.mtime)) {
+			changed(n, fi)
+		}
+		return nil
+	})
+	return stamps
+}
+
+// findByAbsPath returns the Nord under root for the absolute
+// path abs (with or without a trailing separator), or nil.
+func findByAbsPath(root Norder, abs string) Norder {
+	rootPath := FU.StripTrailingPathSep(root.AbsFP())
+	abs = FU.StripTrailingPathSep(abs)
+	if abs == rootPath {
+		return root
+	}
+	rel, ok := S.CutPrefix(abs, rootPath+string(os.PathSeparator))
+	if !ok {
+		return nil
+	}
+	var n = root
+	for _, name := range S.Split(rel, string(os.PathSeparator)) {
+		var k Norder
+		for k = n.FirstKid(); k != nil; k = k.NextKid() {
+			if (NordDirEntry{k}).Name() == name {
+				break
+			}
+		}
+		if k == nil {
+			return nil
+		}
+		n = k
+	}
+	return n
+}
+
+// applyDirChanges reconciles (not deeply) each of the directories
+// dirs, and reports as modified each of the files that was written
+// (unless it was just added). The caller must hold the write lock.
+func (w *Watcher) applyDirChanges(dirs, written []string) (Changes, error) {
+	var c Changes
+	sc, e := dirScanFor(w.root, w.opts.DirTree)
+	if e != nil {
+		return c, fmt.Errorf("Watcher: %w", e)
+	}
+	var ee []error
+	for _, dir := range dirs {
+		n := findByAbsPath(w.root, dir)
+		if n == nil || !n.IsDir() {
+			// Its parent will be (or was) reconciled.
+			continue
+		}
+		// A directory that has vanished just now is not an error.
+		e := c.reconcileDir(n, sc, false)
+		if e != nil && !errors.Is(e, fs.ErrNotExist) {
+			ee = append(ee, e)
+		}
+	}
+	var isNew = make(map[*Nord]bool)
+	for _, n := range c.Added {
+		isNew[n.nord()] = true
+	}
+	for _, fp := range written {
+		n := findByAbsPath(w.root, fp)
+		if n != nil && !n.IsDir() && !isNew[n.nord()] {
+			c.Modified = append(c.Modified, n)
+			isNew[n.nord()] = true
+			fi, _ := os.Lstat(fp)
+			refreshNordInfo(n, fi)
+		}
+	}
+	if len(ee) > 0 {
+		return c, fmt.Errorf("Watcher: %w", errors.Join(ee...))
+	}
+	return c, nil
+}
@@ -0,0 +1,246 @@
+//go:build linux
+
+package orderednodes
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	FP "path/filepath"
+	"sort"
+	S "strings"
+	"unsafe"
+
+	FU "github.com/fbaube/fileutils"
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask is the events that change a directory's list of
+// items, plus a file being written, plus the directory itself
+// being deleted or moved (so that its watch can be dropped).
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM |
+	unix.IN_MOVED_TO | unix.IN_CLOSE_WRITE | unix.IN_DELETE_SELF |
+	unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+// inotify is an inotify instance plus a pipe for waking it up.
+type inotify struct {
+	fd   int
+	wake [2]int
+	// dirs maps a watch descriptor to its directory's path.
+	dirs map[int32]string
+}
+
+// startNotify adds an inotify watch for every directory in the
+// tree, and starts a goroutine that applies the events to the tree.
+func (w *Watcher) startNotify() error {
+	fd, e := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if e != nil {
+		return fmt.Errorf("inotify_init1: %w", e)
+	}
+	n := &inotify{fd: fd, dirs: make(map[int32]string)}
+	if e := unix.Pipe2(n.wake[:], unix.O_CLOEXEC|unix.O_NONBLOCK); e != nil {
+		unix.Close(fd)
+		return fmt.Errorf("pipe2: %w", e)
+	}
+	w.mu.RLock()
+	e = n.watchTree(w.root)
+	w.mu.RUnlock()
+	if e != nil {
+		n.close()
+		return e
+	}
+	w.stopNotify = func() { unix.Write(n.wake[1], []byte{0}) }
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer n.close()
+		n.loop(w)
+	}()
+	return nil
+}
+
+func (n *inotify) close() {
+	unix.Close(n.fd)
+	unix.Close(n.wake[0])
+	unix.Close(n.wake[1])
+}
+
+// watchTree adds a watch for each directory under (and including) p.
+func (n *inotify) watchTree(p Norder) error {
+	return InspectTree(p, func(d Norder) error {
+		if !d.IsDir() {
+			return nil
+		}
+		path := FU.StripTrailingPathSep(d.AbsFP())
+		wd, e := unix.InotifyAddWatch(n.fd, path, inotifyMask)
+		if e != nil {
+			if errors.Is(e, unix.ENOENT) {
+				// It vanished: its parent gets an event.
+				return SkipDir
+			}
+			return fmt.Errorf("inotify_add_watch <%s>: %w", path, e)
+		}
+		n.dirs[int32(wd)] = path
+		return nil
+	})
+}
+
+// loop reads events until it is woken up. Each batch of events is
+// applied by reconciling each directory in which something happened.
+func (n *inotify) loop(w *Watcher) {
+	var buf [64 * 1024]byte
+	fds := []unix.PollFd{
+		{Fd: int32(n.fd), Events: unix.POLLIN},
+		{Fd: int32(n.wake[0]), Events: unix.POLLIN},
+	}
+	for {
+		if _, e := unix.Poll(fds, -1); e != nil {
+			if e == unix.EINTR {
+				continue
+			}
+			w.report(fmt.Errorf("Watcher: poll: %w", e))
+			return
+		}
+		if fds[1].Revents != 0 {
+			return
+		}
+		cnt, e := unix.Read(n.fd, buf[:])
+		if e == unix.EAGAIN || e == unix.EINTR {
+			continue
+		}
+		if e != nil {
+			w.report(fmt.Errorf("Watcher: read: %w", e))
+			return
+		}
+		dirs, written, overflow := n.parse(buf[:cnt])
+		w.mu.Lock()
+		var c Changes
+		if overflow {
+			// Events were lost, so check everything.
+			c, e = ReconcileWith(w.root, w.opts.DirTree)
+		} else {
+			c, e = w.applyDirChanges(dirs, written)
+		}
+		if err := n.watchAdded(w, &c); err != nil {
+			e = errors.Join(e, err)
+		}
+		w.mu.Unlock()
+		w.report(e)
+		if !w.emit(c.events()) {
+			return
+		}
+	}
+}
+
+// watchAdded adds watches for the directories in c.Added, and then
+// reconciles each of them again, so that items that were made in it
+// before its watch was added are not missed. Anything that this adds
+// is appended to c.Added, and so it is watched (and read again) too.
+// The caller must hold the write lock.
+func (n *inotify) watchAdded(w *Watcher, c *Changes) error {
+	var ee []error
+	var sc *dirScan
+	for i := 0; i < len(c.Added); i++ {
+		a := c.Added[i]
+		if !a.IsDir() {
+			continue
+		}
+		if e := n.watchTree(a); e != nil {
+			ee = append(ee, e)
+			continue
+		}
+		if sc == nil {
+			var e error
+			if sc, e = dirScanFor(w.root, w.opts.DirTree); e != nil {
+				return fmt.Errorf("Watcher: %w", e)
+			}
+		}
+		// A directory that has vanished just now is not an error.
+		e := c.reconcileDir(a, sc, true)
+		if e != nil && !errors.Is(e, fs.ErrNotExist) {
+			ee = append(ee, e)
+		}
+	}
+	return errors.Join(ee...)
+}
+
+// forget removes the watch wd (if it is still there).
+func (n *inotify) forget(wd int32) {
+	if _, ok := n.dirs[wd]; ok {
+		delete(n.dirs, wd)
+		unix.InotifyRmWatch(n.fd, uint32(wd))
+	}
+}
+
+// forgetTree removes the watches of the directory dir and of every
+// directory under it, because it was moved away. If it was moved
+// within the tree, it gets new watches when it is added there.
+func (n *inotify) forgetTree(dir string) {
+	for wd, path := range n.dirs {
+		if path == dir || S.HasPrefix(path, dir+string(FP.Separator)) {
+			n.forget(wd)
+		}
+	}
+}
+
+// parse returns the (sorted, unique) directories in which items
+// were added, removed or renamed, and the files that were written
+// (or replaced, as when an editor saves a file by renaming a new
+// one over it). overflow is true if the kernel's event queue
+// overflowed.
+func (n *inotify) parse(buf []byte) (dirs, written []string, overflow bool) {
+	var dirSet = make(map[string]bool)
+	var fileSet = make(map[string]bool)
+	for off := 0; off+unix.SizeofInotifyEvent <= len(buf); {
+		ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		nameStart := off + unix.SizeofInotifyEvent
+		off = nameStart + int(ev.Len)
+		if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+			overflow = true
+			continue
+		}
+		dir, ok := n.dirs[ev.Wd]
+		if !ok {
+			continue
+		}
+		if ev.Mask&unix.IN_IGNORED != 0 {
+			// The directory is gone, or its watch was removed.
+			delete(n.dirs, ev.Wd)
+			continue
+		}
+		if ev.Mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0 {
+			// Its parent gets an event for it, too.
+			n.forget(ev.Wd)
+			continue
+		}
+		name := string(buf[nameStart:min(off, len(buf))])
+		for len(name) > 0 && name[len(name)-1] == 0 {
+			name = name[:len(name)-1]
+		}
+		switch {
+		case ev.Mask&unix.IN_CLOSE_WRITE != 0:
+			fileSet[FP.Join(dir, name)] = true
+		case ev.Mask&(unix.IN_MOVED_TO|unix.IN_CREATE) != 0:
+			// If there was already an item by this name,
+			// and it is kept, it is reported as modified.
+			dirSet[dir] = true
+			fileSet[FP.Join(dir, name)] = true
+		case ev.Mask&unix.IN_MOVED_FROM != 0 && ev.Mask&unix.IN_ISDIR != 0:
+			n.forgetTree(FP.Join(dir, name))
+			dirSet[dir] = true
+		default:
+			dirSet[dir] = true
+		}
+	}
+	for d := range dirSet {
+		dirs = append(dirs, d)
+	}
+	for f := range fileSet {
+		written = append(written, f)
+	}
+	// Parents first, so that a kid's directory is
+	// found even if it was added in the same batch.
+	sort.Strings(dirs)
+	sort.Strings(written)
+	return dirs, written, overflow
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package orderednodes
+
+import "errors"
+
+// startNotify is not available, so a Watcher polls.
+func (w *Watcher) startNotify() error {
+	return errors.New("inotify is available only on Linux")
+}